@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/subtle"
+	"github.com/go-chi/chi"
+	"github.com/thedevsaddam/renderer"
+	"net/http"
+)
+
+func adminHandler() http.Handler {
+	rg := chi.NewRouter()
+	rg.Use(requestTimeout)
+	rg.Use(adminOnly)
+	rg.Group(func(r chi.Router) {
+		r.Get("/maintenance", fetchMaintenance)
+		r.Post("/maintenance", updateMaintenance)
+		r.Post("/indexes/ensure", ensureIndexesHandler)
+		r.Get("/recent-events", fetchRecentEvents)
+		r.Post("/snapshot", createSnapshot)
+	})
+	return rg
+}
+
+// adminOnly lets a request through only when it carries the configured
+// X-Admin-Token. Without ADMIN_TOKEN the admin routes don't exist at all.
+func adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.adminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+		token := r.Header.Get("X-Admin-Token")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.adminToken)) != 1 {
+			rndr.JSON(w, http.StatusUnauthorized, renderer.M{
+				"error": "Invalid admin token",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
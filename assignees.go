@@ -0,0 +1,42 @@
+package main
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+)
+
+// assigneeCount is one assignee with how many todos they hold.
+type assigneeCount struct {
+	Assignee string `json:"assignee" bson:"_id"`
+	Open     int    `json:"open" bson:"open"`
+	Total    int    `json:"total" bson:"total"`
+}
+
+// fetchAssignees lists every assignee of a todo that's neither deleted nor
+// archived, by name, with their open and total counts, for a "filter by
+// person" dropdown.
+func fetchAssignees(w http.ResponseWriter, r *http.Request) {
+	filter := notDeleted()
+	filter["archived"] = bson.M{"$ne": true}
+	filter["assignee"] = bson.M{"$nin": []interface{}{"", nil}}
+
+	pipeline := []bson.M{
+		{"$match": filter},
+		{"$group": bson.M{
+			"_id":   "$assignee",
+			"open":  bson.M{"$sum": bson.M{"$cond": []interface{}{"$completed", 0, 1}}},
+			"total": bson.M{"$sum": 1},
+		}},
+		{"$sort": bson.M{"_id": 1}},
+	}
+
+	assignees := []assigneeCount{}
+	if err := timeQuery(r.Context(), "aggregate", pipeline, func() error {
+		return db.C(collectionName).Pipe(pipeline).All(&assignees)
+	}); err != nil {
+		renderDBError(w, "Failed to fetch assignees", err)
+		return
+	}
+
+	respondOK(w, http.StatusOK, assignees, nil)
+}
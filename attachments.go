@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Attachments only describe files kept elsewhere (e.g. S3); the bytes never
+// pass through this service.
+type (
+	attachmentModel struct {
+		ID          bson.ObjectId `bson:"_id"`
+		Name        string        `bson:"name"`
+		URL         string        `bson:"url"`
+		ContentType string        `bson:"contentType"`
+		Size        int64         `bson:"size"`
+	}
+
+	attachment struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		URL         string `json:"url"`
+		ContentType string `json:"contentType"`
+		Size        int64  `json:"size"`
+	}
+)
+
+func createAttachment(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+
+	if !bson.IsObjectIdHex(id) {
+		if err1 := rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "Invalid URL request",
+		}); err1 != nil {
+			renderFailed(err1)
+			return
+		}
+		return
+	}
+
+	var a attachment
+
+	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+		renderBadBody(w, err)
+		return
+	}
+
+	a.Name = strings.TrimSpace(a.Name)
+	a.URL = strings.TrimSpace(a.URL)
+	a.ContentType = strings.TrimSpace(a.ContentType)
+	if errs := validateAttachment(a); len(errs) > 0 {
+		rndr.JSON(w, http.StatusUnprocessableEntity, renderer.M{
+			"errors": errs,
+		})
+		return
+	}
+
+	am := attachmentModel{
+		ID:          bson.NewObjectId(),
+		Name:        a.Name,
+		URL:         a.URL,
+		ContentType: a.ContentType,
+		Size:        a.Size,
+	}
+
+	// Matching only todos whose last allowed slot is still free enforces the
+	// cap in the same write as the push.
+	var tm todoModel
+	selector := activeTodo(bson.ObjectIdHex(id))
+	selector[fmt.Sprintf("attachments.%d", cfg.maxAttachments-1)] = bson.M{"$exists": false}
+	err := timeQuery(r.Context(), "findAndModify", selector, func() error {
+		_, err := db.C(collectionName).Find(selector).Apply(mgo.Change{
+			Update:    bson.M{"$push": bson.M{"attachments": am}},
+			ReturnNew: true,
+		}, &tm)
+		return err
+	})
+	if err == mgo.ErrNotFound {
+		active := activeTodo(bson.ObjectIdHex(id))
+		var n int
+		err := timeQuery(r.Context(), "count", active, func() (err error) {
+			n, err = db.C(collectionName).Find(active).Count()
+			return err
+		})
+		if err == nil && n == 0 {
+			renderMissingTodo(w, r, bson.ObjectIdHex(id))
+			return
+		}
+		rndr.JSON(w, http.StatusUnprocessableEntity, renderer.M{
+			"errors": []fieldError{{
+				Field:   "attachments",
+				Message: fmt.Sprintf("A todo cannot have more than %d attachments", cfg.maxAttachments),
+			}},
+		})
+		return
+	}
+	if err != nil {
+		renderDBError(w, "Failed to add attachment", err)
+		return
+	}
+
+	respondOK(w, http.StatusCreated, toTodo(tm, time.UTC), renderer.M{
+		"message": "Attachment added successfully",
+	})
+}
+
+func deleteAttachment(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	attachmentID := strings.TrimSpace(chi.URLParam(r, "attachmentId"))
+
+	if !bson.IsObjectIdHex(id) || !bson.IsObjectIdHex(attachmentID) {
+		if err1 := rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "Invalid URL request",
+		}); err1 != nil {
+			renderFailed(err1)
+			return
+		}
+		return
+	}
+
+	var tm todoModel
+	selector := activeTodo(bson.ObjectIdHex(id))
+	selector["attachments._id"] = bson.ObjectIdHex(attachmentID)
+	err := timeQuery(r.Context(), "findAndModify", selector, func() error {
+		_, err := db.C(collectionName).Find(selector).Apply(mgo.Change{
+			Update:    bson.M{"$pull": bson.M{"attachments": bson.M{"_id": bson.ObjectIdHex(attachmentID)}}},
+			ReturnNew: true,
+		}, &tm)
+		return err
+	})
+	if err == mgo.ErrNotFound {
+		rndr.JSON(w, http.StatusNotFound, renderer.M{
+			"error": "Attachment not found",
+		})
+		return
+	}
+	if err != nil {
+		renderDBError(w, "Failed to remove attachment", err)
+		return
+	}
+
+	respondOK(w, http.StatusOK, toTodo(tm, time.UTC), renderer.M{
+		"message": "Attachment removed successfully.",
+	})
+}
+
+func validateAttachment(a attachment) []fieldError {
+	errs := []fieldError{}
+
+	if a.Name == "" {
+		errs = append(errs, fieldError{Field: "name", Message: "The attachment name cannot be empty"})
+	} else if utf8.RuneCountInString(a.Name) > maxAttachmentNameLength {
+		errs = append(errs, fieldError{Field: "name", Message: fmt.Sprintf("The attachment name cannot be longer than %d characters", maxAttachmentNameLength)})
+	}
+
+	if u, err := url.Parse(a.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fieldError{Field: "url", Message: "The attachment url must be an absolute http(s) URL"})
+	}
+
+	if a.Size < 0 {
+		errs = append(errs, fieldError{Field: "size", Message: "The attachment size cannot be negative"})
+	}
+
+	return errs
+}
+
+func toAttachments(as []attachmentModel) []attachment {
+	attachments := []attachment{}
+	for _, a := range as {
+		attachments = append(attachments, attachment{
+			ID:          a.ID.Hex(),
+			Name:        a.Name,
+			URL:         a.URL,
+			ContentType: a.ContentType,
+			Size:        a.Size,
+		})
+	}
+	return attachments
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func withMaxBatchSize(t *testing.T, n int) {
+	prev := cfg.maxBatchSize
+	cfg.maxBatchSize = n
+	t.Cleanup(func() { cfg.maxBatchSize = prev })
+}
+
+func TestBatchTooLarge(t *testing.T) {
+	withMaxBatchSize(t, 3)
+	for n, tooLarge := range map[int]bool{0: false, 1: false, 3: false, 4: true, 1000: true} {
+		w := httptest.NewRecorder()
+		if got := batchTooLarge(w, n); got != tooLarge {
+			t.Errorf("batchTooLarge(%d) = %v, want %v", n, got, tooLarge)
+		}
+		if tooLarge && w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("batchTooLarge(%d) status = %d, want 413", n, w.Code)
+		}
+	}
+
+	cfg.maxBatchSize = 0
+	if batchTooLarge(httptest.NewRecorder(), 100000) {
+		t.Error("MAX_BATCH_SIZE=0 still caps batches")
+	}
+}
+
+func ids(n int) []string {
+	ids := []string{}
+	for i := 0; i < n; i++ {
+		ids = append(ids, fmt.Sprintf("%024x", i+1))
+	}
+	return ids
+}
+
+// Every batch endpoint is capped before it decodes entries or touches
+// Mongo, so none of this needs a database.
+func TestBatchEndpointsAtTheBoundary(t *testing.T) {
+	withMaxBatchSize(t, 3)
+
+	for n, ok := range map[int]bool{3: true, 4: false} {
+		w := httptest.NewRecorder()
+		if _, got := parseIDs(w, ids(n)); got != ok {
+			t.Errorf("parseIDs of %d ids ok = %v, want %v", n, got, ok)
+		}
+	}
+
+	body := `[` + strings.Repeat(`{"title":"t"},`, 3) + `{"title":"t"}]`
+	if w := serve(http.HandlerFunc(bulkCreateTodo), http.MethodPost, "/todo/bulk", body); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("bulk create of 4 = %d, want 413", w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	importText(w, importRequest(strings.Repeat("todo\n", 4), true))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("import of 4 lines = %d, want 413", w.Code)
+	}
+}
+
+// endlessBatch is a JSON array of todos that never ends, counting how much
+// of it has been read.
+type endlessBatch struct {
+	read int
+}
+
+func (b *endlessBatch) Read(p []byte) (int, error) {
+	const entry = `{"title":"todo"},`
+	n := 0
+	if b.read == 0 {
+		p[0] = '['
+		n = 1
+	}
+	for n < len(p) {
+		n += copy(p[n:], entry[(b.read+n-1)%len(entry):])
+	}
+	b.read += n
+	return n, nil
+}
+
+// A batch over the cap is refused once the first entry past it is read,
+// however long the rest of the body is.
+func TestBulkCreateStopsReadingPastTheCap(t *testing.T) {
+	withMaxBatchSize(t, 3)
+	body := &endlessBatch{}
+	r := httptest.NewRequest(http.MethodPost, "/todo/bulk", body)
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	bulkCreateTodo(w, r)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d %s, want 413", w.Code, w.Body)
+	}
+	if body.read > 64<<10 {
+		t.Errorf("read %d bytes of the body before refusing it", body.read)
+	}
+}
+
+func TestDecodeBatchRejectsWhatIsNotAnArray(t *testing.T) {
+	for _, body := range []string{`{"title":"t"}`, `[{"title":"t"}] [{"title":"t"}]`, `[{"title":"t"}`, `"t"`} {
+		w := serve(http.HandlerFunc(bulkCreateTodo), http.MethodPost, "/todo/bulk", body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s = %d %s, want 400", body, w.Code, w.Body)
+		}
+	}
+}
+
+func TestBatchIDsStopAtTheCap(t *testing.T) {
+	withMaxBatchSize(t, 3)
+	tests := []struct {
+		body string
+		ids  int
+		err  error
+	}{
+		{`{"ids":["a","b","c"]}`, 3, nil},
+		{`{"ids":[]}`, 0, nil},
+		{`{"ids":null}`, 0, nil},
+		{`{}`, 0, nil},
+		{`{"ids":["a","b","c","d"]}`, 0, errBatchTooLarge},
+	}
+	for _, tt := range tests {
+		var req trashRequest
+		err := json.Unmarshal([]byte(tt.body), &req)
+		if !errors.Is(err, tt.err) || len(req.IDs) != tt.ids {
+			t.Errorf("%s: %d ids, error %v, want %d and %v", tt.body, len(req.IDs), err, tt.ids, tt.err)
+		}
+	}
+	var req trashRequest
+	if err := json.Unmarshal([]byte(`{"ids":"a"}`), &req); err == nil {
+		t.Error("ids given as a string decode")
+	}
+
+	// The 413 comes from the decode, before the ids are parsed.
+	body := `{"ids":["` + strings.Join(ids(4), `","`) + `"]}`
+	for _, path := range []string{"/", "/tags", "/complete", "/schedule"} {
+		method := http.MethodPost
+		if path == "/" {
+			method = http.MethodDelete
+		}
+		if w := serve(todoHandler(), method, path, body); w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s %s with 4 ids = %d %s, want 413", method, path, w.Code, w.Body)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// fetchTodosByID renders the todos listed in ?ids= in the requested order,
+// with null in place of each id that doesn't exist or is in the trash. The
+// missing ids are also listed in meta.
+func fetchTodosByID(w http.ResponseWriter, r *http.Request, loc *time.Location) {
+	// One id past the cap is enough for the 413, so the rest isn't split.
+	n := -1
+	if cfg.maxBatchSize != 0 {
+		n = cfg.maxBatchSize + 1
+	}
+	raw := strings.SplitN(r.URL.Query().Get("ids"), ",", n)
+	ids, ok := parseIDs(w, raw)
+	if !ok {
+		return
+	}
+
+	todos := []todoModel{}
+	selector := activeTodos(ids)
+	if err := timeQuery(r.Context(), "find", selector, func() error {
+		return db.C(collectionName).Find(selector).All(&todos)
+	}); err != nil {
+		renderDBError(w, "Failed to fetch todo", err)
+		return
+	}
+
+	byID := map[bson.ObjectId]todoModel{}
+	for _, t := range todos {
+		byID[t.ID] = t
+	}
+	data := []interface{}{}
+	missing := []string{}
+	for _, id := range ids {
+		t, ok := byID[id]
+		if !ok {
+			data = append(data, nil)
+			missing = append(missing, id.Hex())
+			continue
+		}
+		data = append(data, toTodo(t, loc))
+	}
+
+	respondOK(w, http.StatusOK, data, renderer.M{
+		"missing": missing,
+	})
+}
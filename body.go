@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/thedevsaddam/renderer"
+	"io"
+	"net/http"
+)
+
+// errBodyTooLarge is returned by the reads of a request body past
+// cfg.maxBodyBytes; renderBadBody answers it with a 413.
+var errBodyTooLarge = errors.New("request body too large")
+
+// limitedBody is a request body that fails with errBodyTooLarge once more
+// than n bytes have been read, rather than ending quietly like
+// io.LimitedReader, so a handler can't mistake a cut body for a whole one.
+type limitedBody struct {
+	io.ReadCloser
+	n int64
+}
+
+// limitBody bounds body to cfg.maxBodyBytes.
+func limitBody(body io.ReadCloser) io.ReadCloser {
+	return &limitedBody{ReadCloser: body, n: cfg.maxBodyBytes}
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.n < 0 {
+		return 0, errBodyTooLarge
+	}
+	if int64(len(p)) > b.n+1 {
+		p = p[:b.n+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > b.n {
+		n = int(b.n)
+		b.n = -1
+		return n, errBodyTooLarge
+	}
+	b.n -= int64(n)
+	return n, err
+}
+
+func renderBodyTooLarge(w http.ResponseWriter) {
+	if err := rndr.JSON(w, http.StatusRequestEntityTooLarge, renderer.M{
+		"error": fmt.Sprintf("The request body cannot be larger than %d bytes", cfg.maxBodyBytes),
+	}); err != nil {
+		renderFailed(err)
+	}
+}
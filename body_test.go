@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLimitedBody(t *testing.T) {
+	defer func(max int64) { cfg.maxBodyBytes = max }(cfg.maxBodyBytes)
+	cfg.maxBodyBytes = 10
+
+	for body, tooLarge := range map[string]bool{"": false, "0123456789": false, "0123456789a": true, strings.Repeat("x", 1000): true} {
+		b, err := ioutil.ReadAll(limitBody(ioutil.NopCloser(strings.NewReader(body))))
+		if tooLarge != errors.Is(err, errBodyTooLarge) {
+			t.Errorf("%d bytes: error %v, want too large %v", len(body), err, tooLarge)
+		}
+		if !tooLarge && string(b) != body {
+			t.Errorf("%d bytes: read %q", len(body), b)
+		}
+		if len(b) > 10 {
+			t.Errorf("%d bytes: read %d past the limit", len(body), len(b))
+		}
+	}
+}
+
+// fieldNaming is the first to read bodies, so it's where they're bounded,
+// whether the length is declared or not.
+func TestFieldNamingBoundsBodies(t *testing.T) {
+	defer func(max int64) { cfg.maxBodyBytes = max }(cfg.maxBodyBytes)
+	cfg.maxBodyBytes = 1 << 10
+	reached := false
+	h := fieldNaming(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		if _, err := ioutil.ReadAll(r.Body); err != nil {
+			renderBadBody(w, err)
+		}
+	}))
+
+	w := serve(h, http.MethodPost, "/todo", `{"title":"`+strings.Repeat("x", 1000)+`"}`)
+	if w.Code == http.StatusRequestEntityTooLarge || !reached {
+		t.Errorf("a body under the limit = %d %s", w.Code, w.Body)
+	}
+
+	reached = false
+	w = serve(h, http.MethodPost, "/todo", `{"title":"`+strings.Repeat("x", 2000)+`"}`)
+	if w.Code != http.StatusRequestEntityTooLarge || reached {
+		t.Errorf("a declared body over the limit = %d %s, want a 413 before the handler", w.Code, w.Body)
+	}
+
+	body := &endlessBatch{}
+	r := httptest.NewRequest(http.MethodPost, "/todo/bulk", body)
+	r.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("an endless body = %d %s, want 413", w.Code, w.Body)
+	}
+	if body.read > 2<<10 {
+		t.Errorf("read %d bytes of an endless body", body.read)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"log"
+	"net/http"
+)
+
+// isDryRun reports whether a destructive bulk request only asks how many
+// todos it would affect.
+func isDryRun(r *http.Request) bool {
+	return r.URL.Query().Get("dryRun") == "true"
+}
+
+// renderWouldAffect answers a dry run with the number of todos matching filter.
+func renderWouldAffect(w http.ResponseWriter, r *http.Request, filter bson.M) {
+	var n int
+	if err := timeQuery(r.Context(), "count", filter, func() (err error) {
+		n, err = db.C(collectionName).Find(filter).Count()
+		return err
+	}); err != nil {
+		renderDBError(w, "Failed to count TODOs", err)
+		return
+	}
+
+	respondOK(w, http.StatusOK, renderer.M{
+		"wouldAffect": n,
+	}, nil)
+}
+
+func completeAllTodo(w http.ResponseWriter, r *http.Request) {
+	filter := notDeleted()
+	filter["completed"] = false
+	filter["archived"] = bson.M{"$ne": true}
+
+	if isDryRun(r) {
+		renderWouldAffect(w, r, filter)
+		return
+	}
+
+	var info *mgo.ChangeInfo
+	if err := timeQuery(r.Context(), "updateAll", filter, func() (err error) {
+		update := bson.M{"$set": bson.M{"completed": true}}
+		setCompletion(update, true)
+		setExpiry(update, true)
+		info, err = db.C(collectionName).UpdateAll(filter, update)
+		return err
+	}); err != nil {
+		renderDBError(w, "Failed to complete TODOs", err)
+		return
+	}
+
+	respondOK(w, http.StatusOK, renderer.M{
+		"modified": info.Updated,
+	}, renderer.M{
+		"message": "TODOs completed successfully.",
+	})
+}
+
+// clearCompletedTodo moves the completed todos to the trash, like DELETE
+// does one at a time. Archived ones are kept out of it, they've already been
+// put away.
+func clearCompletedTodo(w http.ResponseWriter, r *http.Request) {
+	filter := notDeleted()
+	filter["completed"] = true
+	filter["archived"] = bson.M{"$ne": true}
+
+	if isDryRun(r) {
+		renderWouldAffect(w, r, filter)
+		return
+	}
+
+	// The pinned ones among them give their pin slots back afterwards.
+	var pinned []struct {
+		ID bson.ObjectId `bson:"_id"`
+	}
+	pinnedFilter := bson.M{"pinned": true}
+	for k, v := range filter {
+		pinnedFilter[k] = v
+	}
+	if err := timeQuery(r.Context(), "find", pinnedFilter, func() error {
+		return db.C(collectionName).Find(pinnedFilter).Select(bson.M{"_id": 1}).All(&pinned)
+	}); err != nil {
+		renderDBError(w, "Failed to clear completed TODOs", err)
+		return
+	}
+
+	var info *mgo.ChangeInfo
+	if err := timeQuery(r.Context(), "updateAll", filter, func() (err error) {
+		info, err = db.C(collectionName).UpdateAll(filter, trashUpdate())
+		return err
+	}); err != nil {
+		renderDBError(w, "Failed to clear completed TODOs", err)
+		return
+	}
+	released := []bson.ObjectId{}
+	for _, p := range pinned {
+		released = append(released, p.ID)
+	}
+	releasePins(r.Context(), released...)
+
+	respondOK(w, http.StatusOK, renderer.M{
+		"trashed": info.Updated,
+	}, renderer.M{
+		"message": "Completed TODOs moved to the trash.",
+	})
+}
+
+// removeTodos permanently removes the todos matching filter together with
+// their comments. On failure it has already responded and returns false.
+func removeTodos(w http.ResponseWriter, r *http.Request, filter bson.M) (int, bool) {
+	var ids []struct {
+		ID bson.ObjectId `bson:"_id"`
+	}
+	if err := timeQuery(r.Context(), "find", filter, func() error {
+		return db.C(collectionName).Find(filter).Select(bson.M{"_id": 1}).All(&ids)
+	}); err != nil {
+		renderDBError(w, "Failed to remove TODOs", err)
+		return 0, false
+	}
+	removed := []bson.ObjectId{}
+	for _, id := range ids {
+		removed = append(removed, id.ID)
+	}
+
+	var info *mgo.ChangeInfo
+	selector := bson.M{"_id": bson.M{"$in": removed}}
+	if err := timeQuery(r.Context(), "removeAll", selector, func() (err error) {
+		info, err = db.C(collectionName).RemoveAll(selector)
+		return err
+	}); err != nil {
+		renderDBError(w, "Failed to remove TODOs", err)
+		return 0, false
+	}
+
+	comments := bson.M{"todoId": bson.M{"$in": removed}}
+	if err := timeQuery(r.Context(), "removeAll", comments, func() error {
+		_, err := db.C(commentsName).RemoveAll(comments)
+		return err
+	}); err != nil {
+		log.Println("Failed to remove comments of removed TODOs", err)
+	}
+	return info.Removed, true
+}
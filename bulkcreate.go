@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// bulkCreated ties a created todo back to its place in the request.
+type bulkCreated struct {
+	Index int    `json:"index"`
+	ID    string `json:"id"`
+}
+
+// bulkCreateTodo creates every todo of a JSON array in one insert. As with
+// POST /todo an entry may carry its own id; the others are assigned here
+// rather than by the insert, so the response lists them in the request's
+// order. Nothing is written unless every entry is valid.
+func bulkCreateTodo(w http.ResponseWriter, r *http.Request) {
+	entries, ok := decodeBatch(w, r.Body)
+	if !ok {
+		return
+	}
+	if len(entries) == 0 {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "No TODOs given",
+		})
+		return
+	}
+
+	now := time.Now()
+	strict := strictDates(r)
+	todos := make([]todo, len(entries))
+	errs := []fieldError{}
+	warnings := []fieldError{}
+	for i, entry := range entries {
+		prefix := "/" + strconv.Itoa(i)
+
+		d := json.NewDecoder(bytes.NewReader(entry))
+		d.UseNumber()
+		// The entry came out of a valid array, so it decodes.
+		var doc interface{}
+		d.Decode(&doc)
+		if coerceLenient(doc) {
+			entry, _ = json.Marshal(doc)
+		}
+		if schemaErrs := schemaErrors(todoSchema, doc); len(schemaErrs) > 0 {
+			for _, e := range schemaErrs {
+				e.Pointer = prefix + e.Pointer
+				errs = append(errs, e)
+			}
+			continue
+		}
+
+		t := &todos[i]
+		if err := json.Unmarshal(entry, t); err != nil {
+			e := decodeFieldError(err)
+			e.Pointer = prefix + e.Pointer
+			errs = append(errs, e)
+			continue
+		}
+		for _, e := range validateTodo(t) {
+			e.Pointer = prefix + e.Pointer
+			errs = append(errs, e)
+		}
+		if t.CreatedAt.IsZero() {
+			t.CreatedAt = now
+		}
+		dueErrs, dueWarnings := checkDueDate(t, strict)
+		for _, e := range dueErrs {
+			e.Pointer = prefix + e.Pointer
+			errs = append(errs, e)
+		}
+		for _, e := range dueWarnings {
+			e.Pointer = prefix + e.Pointer
+			warnings = append(warnings, e)
+		}
+	}
+	if len(errs) > 0 {
+		rndr.JSON(w, http.StatusUnprocessableEntity, renderer.M{
+			"errors": errs,
+		})
+		return
+	}
+
+	// An id or externalId repeated within the batch would fail the insert
+	// half way, so it's rejected up front.
+	ids := []bson.ObjectId{}
+	seenIDs := map[bson.ObjectId]bool{}
+	duplicateIDs := []string{}
+	for _, t := range todos {
+		if t.ID == "" {
+			continue
+		}
+		id := bson.ObjectIdHex(t.ID)
+		if seenIDs[id] {
+			duplicateIDs = append(duplicateIDs, id.Hex())
+			continue
+		}
+		seenIDs[id] = true
+		ids = append(ids, id)
+	}
+	if len(duplicateIDs) > 0 {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error":      "The same id is listed more than once",
+			"duplicates": duplicateIDs,
+		})
+		return
+	}
+
+	externalIDs := []string{}
+	seen := map[string]bool{}
+	duplicates := []string{}
+	for _, t := range todos {
+		if t.ExternalID == "" {
+			continue
+		}
+		if seen[t.ExternalID] {
+			duplicates = append(duplicates, t.ExternalID)
+			continue
+		}
+		seen[t.ExternalID] = true
+		externalIDs = append(externalIDs, t.ExternalID)
+	}
+	if len(duplicates) > 0 {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error":      "The same externalId is listed more than once",
+			"duplicates": duplicates,
+		})
+		return
+	}
+	if len(externalIDs) > 0 {
+		var existing []struct {
+			ExternalID string `bson:"externalId"`
+		}
+		filter := bson.M{"externalId": bson.M{"$in": externalIDs}}
+		if err := timeQuery(r.Context(), "find", filter, func() error {
+			return db.C(collectionName).Find(filter).Select(bson.M{"externalId": 1}).All(&existing)
+		}); err != nil {
+			renderDBError(w, "Failed to create TODOs", err)
+			return
+		}
+		if len(existing) > 0 {
+			taken := []string{}
+			for _, e := range existing {
+				taken = append(taken, e.ExternalID)
+			}
+			rndr.JSON(w, http.StatusConflict, renderer.M{
+				"error":    "TODOs with these externalIds already exist",
+				"existing": taken,
+			})
+			return
+		}
+	}
+	// Trashed todos keep their id, so they count as taken too.
+	if len(ids) > 0 {
+		var existing []struct {
+			ID bson.ObjectId `bson:"_id"`
+		}
+		filter := bson.M{"_id": bson.M{"$in": ids}}
+		if err := timeQuery(r.Context(), "find", filter, func() error {
+			return db.C(collectionName).Find(filter).Select(bson.M{"_id": 1}).All(&existing)
+		}); err != nil {
+			renderDBError(w, "Failed to create TODOs", err)
+			return
+		}
+		if len(existing) > 0 {
+			taken := []string{}
+			for _, e := range existing {
+				taken = append(taken, e.ID.Hex())
+			}
+			rndr.JSON(w, http.StatusConflict, renderer.M{
+				"error":    "TODOs with these ids already exist",
+				"existing": taken,
+			})
+			return
+		}
+	}
+
+	position, err := nextPosition(r.Context())
+	if err != nil {
+		renderDBError(w, "Failed to create TODOs", err)
+		return
+	}
+
+	docs := make([]interface{}, len(todos))
+	created := make([]bulkCreated, len(todos))
+	for i, t := range todos {
+		id := bson.NewObjectId()
+		if t.ID != "" {
+			id = bson.ObjectIdHex(t.ID)
+		}
+		tm := &todoModel{
+			ID:              id,
+			Title:           t.Title,
+			ExternalID:      t.ExternalID,
+			Description:     t.Description,
+			Completed:       t.Completed,
+			Assignee:        t.Assignee,
+			Tags:            t.Tags,
+			EstimateMinutes: t.EstimateMinutes,
+			Priority:        priorityRanks[t.Priority],
+			DueDate:         utcTime(t.DueDate),
+			Position:        position + i,
+			SortKey:         t.SortKey,
+			Metadata:        t.Metadata,
+			CreatedAt:       t.CreatedAt.UTC(),
+			CompletedAt:     completedAt(t.Completed),
+			ExpireAt:        expireAt(t.Completed),
+		}
+		docs[i] = tm
+		created[i] = bulkCreated{Index: i, ID: tm.ID.Hex()}
+	}
+
+	// A concurrent create can still take an id or externalId after the
+	// checks; the insert then fails with a duplicate key, answered as a 409.
+	if err := timeQuery(r.Context(), "insert", nil, func() error {
+		return db.C(collectionName).Insert(docs...)
+	}); err != nil {
+		renderDBError(w, "Failed to create TODOs", err)
+		return
+	}
+
+	meta := renderer.M{
+		"message": "TODOs created successfully",
+	}
+	if len(warnings) > 0 {
+		meta["warnings"] = warnings
+	}
+	respondOK(w, http.StatusCreated, created, meta)
+}
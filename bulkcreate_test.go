@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// A batch repeating an externalId is refused before Mongo is touched, so
+// this runs without a database.
+func TestBulkCreateRejectsDuplicateExternalIDs(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		duplicates []interface{}
+	}{
+		{"repeated", `[{"title":"a","externalId":"X-1"},{"title":"b","externalId":"X-1"}]`, []interface{}{"X-1"}},
+		{"repeated after trimming", `[{"title":"a","externalId":"X-1"},{"title":"b","externalId":" X-1 "}]`, []interface{}{"X-1"}},
+		{"several", `[{"title":"a","externalId":"X-1"},{"title":"b","externalId":"X-2"},{"title":"c","externalId":"X-2"},{"title":"d","externalId":"X-1"}]`, []interface{}{"X-2", "X-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(http.HandlerFunc(bulkCreateTodo), http.MethodPost, "/todo/bulk", tt.body)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d %s, want 400", w.Code, w.Body)
+			}
+			var resp struct {
+				Duplicates []interface{} `json:"duplicates"`
+			}
+			decodeBody(t, w, &resp)
+			if !reflect.DeepEqual(resp.Duplicates, tt.duplicates) {
+				t.Errorf("duplicates = %v, want %v", resp.Duplicates, tt.duplicates)
+			}
+		})
+	}
+}
+
+// Todos without an externalId never collide with each other.
+func TestBulkCreateWithoutExternalIDs(t *testing.T) {
+	testDB(t)
+	w := serve(http.HandlerFunc(bulkCreateTodo), http.MethodPost, "/todo/bulk", `[{"title":"a"},{"title":"a"},{"title":"b","externalId":""}]`)
+	if w.Code != http.StatusCreated {
+		t.Errorf("status = %d %s, want 201", w.Code, w.Body)
+	}
+}
+
+func TestBulkCreateRejectsDuplicateIDs(t *testing.T) {
+	id := "5f1d7a3e9b1e8a3c4d2f0a11"
+	body := fmt.Sprintf(`[{"id":%q,"title":"a"},{"title":"b"},{"id":%q,"title":"c"}]`, id, strings.ToUpper(id))
+	w := serve(http.HandlerFunc(bulkCreateTodo), http.MethodPost, "/todo/bulk", body)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d %s, want 400", w.Code, w.Body)
+	}
+	var resp struct {
+		Duplicates []string `json:"duplicates"`
+	}
+	decodeBody(t, w, &resp)
+	if !reflect.DeepEqual(resp.Duplicates, []string{id}) {
+		t.Errorf("duplicates = %v, want [%s]", resp.Duplicates, id)
+	}
+}
+
+func TestBulkCreateWithClientIDs(t *testing.T) {
+	testDB(t)
+	h := http.HandlerFunc(bulkCreateTodo)
+	a, b := bson.NewObjectId(), bson.NewObjectId()
+
+	w := serve(h, http.MethodPost, "/todo/bulk", fmt.Sprintf(`[{"id":%q,"title":"a"},{"title":"b"},{"id":%q,"title":"c"}]`, a.Hex(), b.Hex()))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d %s, want 201", w.Code, w.Body)
+	}
+	var resp struct {
+		Data []bulkCreated `json:"data"`
+	}
+	decodeBody(t, w, &resp)
+	if len(resp.Data) != 3 || resp.Data[0].ID != a.Hex() || resp.Data[2].ID != b.Hex() || !bson.IsObjectIdHex(resp.Data[1].ID) {
+		t.Fatalf("created = %+v, want the client ids kept in place", resp.Data)
+	}
+	if tm := storedTodo(t, a); tm.Title != "a" {
+		t.Errorf("todo %s = %q, want a", a.Hex(), tm.Title)
+	}
+
+	// A taken id fails the whole batch, the new entries included.
+	fresh := bson.NewObjectId()
+	w = serve(h, http.MethodPost, "/todo/bulk", fmt.Sprintf(`[{"id":%q,"title":"d"},{"id":%q,"title":"e"}]`, fresh.Hex(), b.Hex()))
+	var conflict struct {
+		Existing []string `json:"existing"`
+	}
+	decodeBody(t, w, &conflict)
+	if w.Code != http.StatusConflict || !reflect.DeepEqual(conflict.Existing, []string{b.Hex()}) {
+		t.Errorf("taken id = %d %s, want 409 listing %s", w.Code, w.Body, b.Hex())
+	}
+	if n, _ := db.C(collectionName).FindId(fresh).Count(); n != 0 {
+		t.Error("the rest of a conflicting batch was inserted")
+	}
+	if tm := storedTodo(t, b); tm.Title != "c" {
+		t.Errorf("the conflicting entry overwrote %s: %q", b.Hex(), tm.Title)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"net/http"
+	"time"
+)
+
+// bulkUpdateRequest sets the fields of set on every todo matching filter,
+// a search expression as taken by POST /todo/search.
+type bulkUpdateRequest struct {
+	Filter *filterNode                `json:"filter"`
+	Set    map[string]json.RawMessage `json:"set"`
+}
+
+// bulkUpdateTodo applies one field patch to every todo matching a filter,
+// such as raising the priority of everything overdue. The filter goes
+// through the same whitelist as a search and the patch through the PATCH
+// schema and field rules, so neither side reaches Mongo as written. An
+// update without a filter has to be confirmed with ?confirm=true.
+func bulkUpdateTodo(w http.ResponseWriter, r *http.Request) {
+	var req bulkUpdateRequest
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+	if err := d.Decode(&req); err != nil {
+		renderBadBody(w, err)
+		return
+	}
+	if len(req.Set) == 0 {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "Nothing to set",
+		})
+		return
+	}
+	// completedAt is only consistent when set together with completed on
+	// one todo, so it's left to PATCH.
+	if _, ok := req.Set["completedAt"]; ok {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "completedAt cannot be bulk updated",
+		})
+		return
+	}
+	if req.Filter == nil && r.URL.Query().Get("confirm") != "true" {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "Updating every TODO needs a filter or ?confirm=true",
+		})
+		return
+	}
+
+	filter, err := todoFilter(r)
+	if err != nil {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": err.Error(),
+		})
+		return
+	}
+	if req.Filter != nil {
+		conditions := 0
+		expr, err := filterQuery(*req.Filter, "/filter", 1, &conditions)
+		if err != nil {
+			rndr.JSON(w, http.StatusBadRequest, renderer.M{
+				"error": err.Error(),
+			})
+			return
+		}
+		filter["$and"] = []interface{}{expr}
+	}
+
+	// The patch is checked like a PATCH of a todo that only has its
+	// fields, keeping the errors about those fields.
+	raw, _ := json.Marshal(req.Set)
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc interface{}
+	dec.Decode(&doc)
+	coerceLenient(doc)
+	if errs := schemaErrors(todoPatchSchema, doc); len(errs) > 0 {
+		for i := range errs {
+			errs[i].Pointer = "/set" + errs[i].Pointer
+		}
+		rndr.JSON(w, http.StatusUnprocessableEntity, renderer.M{
+			"errors": errs,
+		})
+		return
+	}
+	raw, _ = json.Marshal(doc)
+	t := todo{Title: "-", CreatedAt: time.Now()}
+	if err := json.Unmarshal(raw, &t); err != nil {
+		renderBadBody(w, err)
+		return
+	}
+	errs := []fieldError{}
+	for _, e := range validateTodo(&t) {
+		if _, ok := req.Set[e.Field]; ok {
+			e.Pointer = "/set" + e.Pointer
+			errs = append(errs, e)
+		}
+	}
+	if len(errs) > 0 {
+		rndr.JSON(w, http.StatusUnprocessableEntity, renderer.M{
+			"errors": errs,
+		})
+		return
+	}
+
+	update := patchUpdate(req.Set, t)
+	var info *mgo.ChangeInfo
+	if err := timeQuery(r.Context(), "updateAll", filter, func() (err error) {
+		info, err = db.C(collectionName).UpdateAll(filter, update)
+		return err
+	}); err != nil {
+		renderDBError(w, "Failed to update TODOs", err)
+		return
+	}
+
+	respondOK(w, http.StatusOK, renderer.M{
+		"matched":  info.Matched,
+		"modified": info.Updated,
+	}, renderer.M{
+		"message": "TODOs updated successfully.",
+	})
+}
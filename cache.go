@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"github.com/thedevsaddam/renderer"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// staleWarning marks a response served from the read cache because Mongo
+// couldn't be reached.
+const staleWarning = `110 - "Response is Stale"`
+
+// cachedHeaders are the response headers kept with a cached read.
+var cachedHeaders = []string{"Content-Type", "X-Total-Count", "Link"}
+
+type cachedResponse struct {
+	key      string
+	header   http.Header
+	body     []byte
+	storedAt time.Time
+}
+
+// readCache is a fixed size LRU of the last successful reads, keyed by
+// request URI. It's only consulted when a read fails, so it never hides
+// fresh data.
+type readCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+var reads *readCache
+
+func newReadCache(size int) *readCache {
+	return &readCache{size: size, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (c *readCache) get(key string) (*cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	resp := e.Value.(*cachedResponse)
+	if time.Since(resp.storedAt) > cfg.readCacheTTL {
+		c.order.Remove(e)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return resp, true
+}
+
+func (c *readCache) put(resp *cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[resp.key]; ok {
+		e.Value = resp
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[resp.key] = c.order.PushFront(resp)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedResponse).key)
+	}
+}
+
+// recorder buffers a response so cacheReads can decide what to send.
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *recorder) Header() http.Header { return rec.header }
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.body.Write(b)
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
+
+// cacheReads remembers successful reads and, when Mongo fails on a later
+// read of the same URI, serves the remembered response with a Warning
+// header, or a 503 when there is none. Buffering gives up streaming of large
+// lists, which is why the cache is off unless READ_CACHE_SIZE is set.
+func cacheReads(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if reads == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &recorder{header: http.Header{}}
+		next.ServeHTTP(rec, r)
+		key := r.URL.RequestURI()
+
+		switch {
+		// renderDBError answers with a 503 when Mongo can't be reached.
+		case rec.status == http.StatusServiceUnavailable:
+			resp, ok := reads.get(key)
+			if !ok {
+				rndr.JSON(w, http.StatusServiceUnavailable, renderer.M{
+					"error": "The database is unavailable, please retry later.",
+				})
+				return
+			}
+			for k, v := range resp.header {
+				w.Header()[k] = v
+			}
+			w.Header().Set("Warning", staleWarning)
+			w.WriteHeader(http.StatusOK)
+			w.Write(resp.body)
+			return
+		// A list cut short mid-stream isn't worth keeping.
+		case rec.status == http.StatusOK && json.Valid(rec.body.Bytes()):
+			resp := &cachedResponse{key: key, header: http.Header{}, body: rec.body.Bytes(), storedAt: time.Now()}
+			for _, k := range cachedHeaders {
+				if v := rec.header.Get(k); v != "" {
+					resp.header.Set(k, v)
+				}
+			}
+			reads.put(resp)
+		}
+
+		for k, v := range rec.header {
+			w.Header()[k] = v
+		}
+		if rec.status != 0 {
+			w.WriteHeader(rec.status)
+		}
+		w.Write(rec.body.Bytes())
+	})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func withCaps(t *testing.T, n int) {
+	tags, attachments, metadata := cfg.maxTags, cfg.maxAttachments, cfg.maxMetadataEntries
+	cfg.maxTags, cfg.maxAttachments, cfg.maxMetadataEntries = n, n, n
+	t.Cleanup(func() {
+		cfg.maxTags, cfg.maxAttachments, cfg.maxMetadataEntries = tags, attachments, metadata
+	})
+}
+
+func hasFieldError(errs []fieldError, field string) bool {
+	for _, e := range errs {
+		if e.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValidateTodoCaps(t *testing.T) {
+	withCaps(t, 3)
+	full := todo{
+		Title:    "Ship it",
+		Tags:     []string{"a", "b", "c"},
+		Metadata: map[string]string{"a": "1", "b": "2", "c": "3"},
+	}
+	if errs := validateTodo(&full); len(errs) != 0 {
+		t.Errorf("a todo at the caps is rejected: %v", errs)
+	}
+
+	over := full
+	over.Tags = append(over.Tags, "d")
+	over.Metadata = map[string]string{"a": "1", "b": "2", "c": "3", "d": "4"}
+	errs := validateTodo(&over)
+	for _, field := range []string{"tags", "metadata"} {
+		if !hasFieldError(errs, field) {
+			t.Errorf("%s one past the cap isn't rejected: %v", field, errs)
+		}
+	}
+}
+
+// Going over a cap is a 422 naming the field, never a 500 or a todo saved
+// with one entry too many.
+func TestCreateOverCaps(t *testing.T) {
+	withCaps(t, 3)
+	h := todoHandler()
+	for field, body := range map[string]string{
+		"tags":     `{"title":"Ship it","tags":["a","b","c","d"]}`,
+		"metadata": `{"title":"Ship it","metadata":{"a":"1","b":"2","c":"3","d":"4"}}`,
+	} {
+		w := serve(h, http.MethodPost, "/validate", body)
+		var resp struct {
+			Errors []fieldError `json:"errors"`
+		}
+		decodeBody(t, w, &resp)
+		if w.Code != http.StatusUnprocessableEntity || !hasFieldError(resp.Errors, field) {
+			t.Errorf("%s past the cap = %d %s, want 422 on %s", field, w.Code, w.Body, field)
+		}
+	}
+}
+
+func TestAddPastCaps(t *testing.T) {
+	testDB(t)
+	withCaps(t, 3)
+	h := todoHandler()
+	full := insertTodo(t, todoModel{Title: "full", Tags: []string{"a", "b", "c"}})
+	roomy := insertTodo(t, todoModel{Title: "roomy", Tags: []string{"a"}})
+
+	w := serve(h, http.MethodPost, "/tags", fmt.Sprintf(`{"ids":[%q,%q],"add":["d"]}`, full.Hex(), roomy.Hex()))
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), full.Hex()) || strings.Contains(w.Body.String(), roomy.Hex()) {
+		t.Errorf("tag add past the cap = %d %s, want 422 naming only the full todo", w.Code, w.Body)
+	}
+	if tags := storedTodo(t, roomy).Tags; len(tags) != 1 {
+		t.Errorf("the rejected add still tagged the other todo: %v", tags)
+	}
+	// Re-adding tags a todo already has doesn't count against the cap.
+	if w := serve(h, http.MethodPost, "/tags", fmt.Sprintf(`{"ids":[%q],"add":["a","b"]}`, full.Hex())); w.Code != http.StatusOK {
+		t.Errorf("re-adding existing tags = %d %s, want 200", w.Code, w.Body)
+	}
+
+	id := insertTodo(t, todoModel{Title: "attached"})
+	path := "/" + id.Hex() + "/attachments"
+	body := `{"name":"spec.pdf","url":"https://example.com/spec.pdf","contentType":"application/pdf","size":10}`
+	for i := 0; i < 3; i++ {
+		if w := serve(h, http.MethodPost, path, body); w.Code != http.StatusCreated {
+			t.Fatalf("attachment %d = %d %s, want 201", i+1, w.Code, w.Body)
+		}
+	}
+	if w := serve(h, http.MethodPost, path, body); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("attachment past the cap = %d %s, want 422", w.Code, w.Body)
+	}
+	if n := len(storedTodo(t, id).Attachments); n != 3 {
+		t.Errorf("%d attachments stored, want 3", n)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type (
+	commentModel struct {
+		ID        bson.ObjectId `bson:"_id,omitempty"`
+		TodoID    bson.ObjectId `bson:"todoId"`
+		Author    string        `bson:"author"`
+		Body      string        `bson:"body"`
+		CreatedAt time.Time     `bson:"createdAt"`
+	}
+
+	comment struct {
+		ID        string    `json:"id"`
+		TodoID    string    `json:"todoId"`
+		Author    string    `json:"author"`
+		Body      string    `json:"body"`
+		CreatedAt time.Time `json:"createdAt"`
+	}
+)
+
+func createComment(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+
+	if !bson.IsObjectIdHex(id) {
+		if err1 := rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "Invalid URL request",
+		}); err1 != nil {
+			renderFailed(err1)
+			return
+		}
+		return
+	}
+
+	var c comment
+
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		renderBadBody(w, err)
+		return
+	}
+
+	c.Author = strings.TrimSpace(c.Author)
+	c.Body = strings.TrimSpace(c.Body)
+	errs := []fieldError{}
+	if c.Body == "" {
+		errs = append(errs, fieldError{Field: "body", Message: "The comment cannot be empty"})
+	} else if utf8.RuneCountInString(c.Body) > maxCommentLength {
+		errs = append(errs, fieldError{Field: "body", Message: fmt.Sprintf("The comment cannot be longer than %d characters", maxCommentLength)})
+	}
+	if utf8.RuneCountInString(c.Author) > maxAuthorLength {
+		errs = append(errs, fieldError{Field: "author", Message: fmt.Sprintf("The author cannot be longer than %d characters", maxAuthorLength)})
+	}
+	if len(errs) > 0 {
+		rndr.JSON(w, http.StatusUnprocessableEntity, renderer.M{
+			"errors": errs,
+		})
+		return
+	}
+
+	cm := commentModel{
+		ID:        bson.NewObjectId(),
+		TodoID:    bson.ObjectIdHex(id),
+		Author:    c.Author,
+		Body:      c.Body,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	// The counter is bumped first: it doubles as the existence check for the
+	// todo, and $inc keeps it right under concurrent comments. A failed
+	// insert takes the increment back.
+	selector := activeTodo(cm.TodoID)
+	if err := timeQuery(r.Context(), "update", selector, func() error {
+		return db.C(collectionName).Update(selector, bson.M{"$inc": bson.M{"commentCount": 1}})
+	}); err != nil {
+		if err == mgo.ErrNotFound {
+			renderMissingTodo(w, r, cm.TodoID)
+			return
+		}
+		renderDBError(w, "Failed to create comment", err)
+		return
+	}
+
+	if err := timeQuery(r.Context(), "insert", nil, func() error {
+		return db.C(commentsName).Insert(&cm)
+	}); err != nil {
+		undo := bson.M{"_id": cm.TodoID}
+		timeQuery(r.Context(), "update", undo, func() error {
+			return db.C(collectionName).Update(undo, bson.M{"$inc": bson.M{"commentCount": -1}})
+		})
+		renderDBError(w, "Failed to create comment", err)
+		return
+	}
+
+	respondOK(w, http.StatusCreated, toComment(cm, time.UTC), renderer.M{
+		"message": "Comment created successfully",
+	})
+}
+
+func fetchComments(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+
+	if !bson.IsObjectIdHex(id) {
+		if err1 := rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "Invalid URL request",
+		}); err1 != nil {
+			renderFailed(err1)
+			return
+		}
+		return
+	}
+
+	loc, ok := parseTimezone(w, r)
+	if !ok {
+		return
+	}
+
+	if !requireActiveTodo(w, r, bson.ObjectIdHex(id)) {
+		return
+	}
+
+	limit, offset, err := parsePagination(r, cfg.defaultPageSize)
+	if err != nil {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	comments := []commentModel{}
+
+	filter := bson.M{"todoId": bson.ObjectIdHex(id)}
+	var total int
+	if err := timeQuery(r.Context(), "find", filter, func() (err error) {
+		if total, err = db.C(commentsName).Find(filter).Count(); err != nil {
+			return err
+		}
+		return db.C(commentsName).Find(filter).Sort("createdAt", "_id").Skip(offset).Limit(limit).All(&comments)
+	}); err != nil {
+		renderDBError(w, "Failed to fetch comments", err)
+		return
+	}
+
+	commentList := []comment{}
+	for _, c := range comments {
+		commentList = append(commentList, toComment(c, loc))
+	}
+	setPaginationHeaders(w, r, total, limit, offset)
+	respondOK(w, http.StatusOK, commentList, pageMeta(total, limit, offset))
+}
+
+func deleteComment(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	commentID := strings.TrimSpace(chi.URLParam(r, "commentId"))
+
+	if !bson.IsObjectIdHex(id) || !bson.IsObjectIdHex(commentID) {
+		if err1 := rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "Invalid URL request",
+		}); err1 != nil {
+			renderFailed(err1)
+			return
+		}
+		return
+	}
+
+	if !requireActiveTodo(w, r, bson.ObjectIdHex(id)) {
+		return
+	}
+
+	// Only a comment that was actually removed takes the counter down, so a
+	// repeated delete can't drive it negative.
+	selector := bson.M{
+		"_id":    bson.ObjectIdHex(commentID),
+		"todoId": bson.ObjectIdHex(id),
+	}
+	if err := timeQuery(r.Context(), "remove", selector, func() error {
+		return db.C(commentsName).Remove(selector)
+	}); err != nil {
+		if err == mgo.ErrNotFound {
+			rndr.JSON(w, http.StatusNotFound, renderer.M{
+				"error": "Comment not found",
+			})
+			return
+		}
+		renderDBError(w, "Failed to remove comment", err)
+		return
+	}
+
+	counter := activeTodo(bson.ObjectIdHex(id))
+	if err := timeQuery(r.Context(), "update", counter, func() error {
+		return db.C(collectionName).Update(counter, bson.M{"$inc": bson.M{"commentCount": -1}})
+	}); err != nil && err != mgo.ErrNotFound {
+		renderDBError(w, "Failed to update comment count", err)
+		return
+	}
+
+	respondOK(w, http.StatusOK, renderer.M{
+		"id": commentID,
+	}, renderer.M{
+		"message": "Comment deleted successfully.",
+	})
+}
+
+// requireActiveTodo checks that the todo whose comments are asked for
+// exists and isn't in the trash, answering like renderMissingTodo when it
+// doesn't.
+func requireActiveTodo(w http.ResponseWriter, r *http.Request, id bson.ObjectId) bool {
+	selector := activeTodo(id)
+	var n int
+	if err := timeQuery(r.Context(), "count", selector, func() (err error) {
+		n, err = db.C(collectionName).Find(selector).Count()
+		return err
+	}); err != nil {
+		renderDBError(w, "Failed to fetch todo", err)
+		return false
+	}
+	if n == 0 {
+		renderMissingTodo(w, r, id)
+		return false
+	}
+	return true
+}
+
+func toComment(c commentModel, loc *time.Location) comment {
+	return comment{
+		ID:        c.ID.Hex(),
+		TodoID:    c.TodoID.Hex(),
+		Author:    c.Author,
+		Body:      c.Body,
+		CreatedAt: c.CreatedAt.In(loc),
+	}
+}
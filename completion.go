@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"time"
+)
+
+type completeRequest struct {
+	IDs       batchIDs `json:"ids"`
+	Completed *bool    `json:"completed"`
+}
+
+// completedAt is the completion time of a todo created with the given
+// completion, or nil when it's still open.
+func completedAt(completed bool) *time.Time {
+	if !completed {
+		return nil
+	}
+	t := time.Now().UTC()
+	return &t
+}
+
+// setCompletion adds the completedAt change matching completed to an update.
+// $min keeps the original completion time when an already completed todo is
+// completed again. Completing a todo also ends its lease.
+func setCompletion(update bson.M, completed bool) {
+	unset, ok := update["$unset"].(bson.M)
+	if !ok {
+		unset = bson.M{}
+		update["$unset"] = unset
+	}
+	if completed {
+		minUpdate(update)["completedAt"] = *completedAt(true)
+		unset["leaseOwner"] = ""
+		unset["leasedAt"] = ""
+		unset["leaseExpiresAt"] = ""
+		return
+	}
+	unset["completedAt"] = ""
+}
+
+// minUpdate returns the $min of update, adding it when it has none yet.
+func minUpdate(update bson.M) bson.M {
+	min, ok := update["$min"].(bson.M)
+	if !ok {
+		min = bson.M{}
+		update["$min"] = min
+	}
+	return min
+}
+
+func completeTodo(w http.ResponseWriter, r *http.Request) {
+	var req completeRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		renderBadBody(w, err)
+		return
+	}
+
+	ids, ok := parseIDs(w, req.IDs)
+	if !ok {
+		return
+	}
+	if req.Completed == nil {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "Missing completed",
+		})
+		return
+	}
+	notFound, ok := missingIDs(w, r, ids)
+	if !ok {
+		return
+	}
+	selector := activeTodos(ids)
+
+	update := bson.M{"$set": bson.M{"completed": *req.Completed}}
+	setCompletion(update, *req.Completed)
+	setExpiry(update, *req.Completed)
+
+	var info *mgo.ChangeInfo
+	if err := timeQuery(r.Context(), "updateAll", selector, func() (err error) {
+		info, err = db.C(collectionName).UpdateAll(selector, update)
+		return err
+	}); err != nil {
+		renderDBError(w, "Failed to update TODOs", err)
+		return
+	}
+
+	respondOK(w, http.StatusOK, renderer.M{
+		"modified": info.Updated,
+		"notFound": notFound,
+	}, renderer.M{
+		"message": "TODOs updated successfully.",
+	})
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// config holds the settings read from the environment at startup.
+type config struct {
+	// slowQuery is the duration after which a DB operation is logged as slow
+	// (SLOW_QUERY_MS).
+	slowQuery time.Duration
+	// maintenance starts the server in maintenance mode (MAINTENANCE_MODE).
+	maintenance bool
+	// adminToken guards the /admin routes (ADMIN_TOKEN); they are disabled
+	// when it's empty.
+	adminToken string
+	// defaultPageSize is the page size of list endpoints without ?limit=
+	// (DEFAULT_PAGE_SIZE).
+	defaultPageSize int
+	// viewPageSizes are the default page sizes of todo lists per ?view=
+	// (SUMMARY_PAGE_SIZE, FULL_PAGE_SIZE), falling back to defaultPageSize.
+	viewPageSizes map[string]int
+	// maxPageSize caps every page, explicit or default (MAX_PAGE_SIZE).
+	maxPageSize int
+	// completedTTL is how long completed todos are kept before Mongo
+	// removes them (COMPLETED_TTL, e.g. "72h"); 0 keeps them forever.
+	completedTTL time.Duration
+	// corsOrigins are the origins allowed to call the API cross-origin
+	// (CORS_ORIGINS, comma separated, "*" for any); CORS is off when empty.
+	corsOrigins []string
+	// corsCredentials lets cross-origin requests carry cookies
+	// (CORS_ALLOW_CREDENTIALS).
+	corsCredentials bool
+	// corsMaxAge is how long browsers may cache a preflight (CORS_MAX_AGE).
+	corsMaxAge time.Duration
+	// corsExposedHeaders are the response headers readable cross-origin
+	// (CORS_EXPOSED_HEADERS).
+	corsExposedHeaders []string
+	// readCacheSize is how many reads are kept to answer while Mongo is
+	// down (READ_CACHE_SIZE); 0 disables the cache.
+	readCacheSize int
+	// readCacheTTL is how old a cached read may be when it's served
+	// (READ_CACHE_TTL).
+	readCacheTTL time.Duration
+	// basePath prefixes every route, for running behind a reverse proxy
+	// under a subpath (BASE_PATH, e.g. "/api/todo-service").
+	basePath string
+	// leaseDuration is how long a worker holds the todo it got from
+	// POST /todo/next (LEASE_DURATION).
+	leaseDuration time.Duration
+	// requestTimeout bounds every API request and DB operation
+	// (REQUEST_TIMEOUT); 0 leaves them unbounded.
+	requestTimeout time.Duration
+	// maxPinned caps how many todos can be pinned at once (MAX_PINNED).
+	maxPinned int
+	// timingHeaders adds X-Response-Time and Server-Timing to responses
+	// (TIMING_HEADERS).
+	timingHeaders bool
+	// naming is the default key style of JSON responses (JSON_NAMING,
+	// "camel" or "snake").
+	naming string
+	// strictContentType rejects JSON write bodies sent without an
+	// application/json Content-Type (STRICT_CONTENT_TYPE).
+	strictContentType bool
+	// homePage picks the home page (HOME_PAGE): "app", the Vue app, or
+	// "server", a plain server-rendered list with an add form.
+	homePage string
+	// maxBatchSize caps the items of one bulk or batch request: todos
+	// created, lines imported or ids acted on (MAX_BATCH_SIZE).
+	maxBatchSize int
+	// eventLogSize is how many recent mutations GET /admin/recent-events
+	// keeps in memory (EVENT_LOG_SIZE); 0 disables the log.
+	eventLogSize int
+	// defaultHideCompleted leaves completed todos out of GET /todo unless
+	// it's given ?includeCompleted=true or ?completed=true
+	// (DEFAULT_HIDE_COMPLETED).
+	defaultHideCompleted bool
+	// lenientDecode accepts 0/1 and "true"/"false" for the boolean fields
+	// of todo payloads, for older clients (LENIENT_DECODE).
+	lenientDecode bool
+	// maxTags, maxAttachments and maxMetadataEntries cap the nested lists
+	// of a todo, which keeps documents far from Mongo's 16MB limit
+	// (MAX_TAGS_PER_TODO, MAX_ATTACHMENTS_PER_TODO, MAX_METADATA_ENTRIES).
+	maxTags            int
+	maxAttachments     int
+	maxMetadataEntries int
+	// maxBodyBytes caps the size of a request body (MAX_BODY_BYTES); the
+	// default leaves room for a full batch of long todos.
+	maxBodyBytes int64
+}
+
+var cfg config
+
+func loadConfig() config {
+	defaultPageSize := envPositiveInt("DEFAULT_PAGE_SIZE", 50)
+	return config{
+		slowQuery:   envMilliseconds("SLOW_QUERY_MS", 200*time.Millisecond),
+		maintenance: envBool("MAINTENANCE_MODE", false),
+		adminToken:  os.Getenv("ADMIN_TOKEN"),
+
+		defaultPageSize: defaultPageSize,
+		viewPageSizes: map[string]int{
+			viewSummary: envInt("SUMMARY_PAGE_SIZE", defaultPageSize),
+			viewFull:    envInt("FULL_PAGE_SIZE", defaultPageSize),
+		},
+		maxPageSize: envInt("MAX_PAGE_SIZE", 500),
+
+		completedTTL: envDuration("COMPLETED_TTL", 0),
+
+		corsOrigins:        envList("CORS_ORIGINS", nil),
+		corsCredentials:    envBool("CORS_ALLOW_CREDENTIALS", false),
+		corsMaxAge:         envDuration("CORS_MAX_AGE", 10*time.Minute),
+		corsExposedHeaders: envList("CORS_EXPOSED_HEADERS", []string{"X-Total-Count", "X-Result-Truncated", "Link"}),
+
+		readCacheSize: envInt("READ_CACHE_SIZE", 0),
+		readCacheTTL:  envDuration("READ_CACHE_TTL", 5*time.Minute),
+
+		basePath: envBasePath("BASE_PATH"),
+
+		leaseDuration:  envDuration("LEASE_DURATION", 5*time.Minute),
+		requestTimeout: envDuration("REQUEST_TIMEOUT", 30*time.Second),
+
+		maxPinned:     envInt("MAX_PINNED", 5),
+		timingHeaders: envBool("TIMING_HEADERS", false),
+		naming:        envNaming("JSON_NAMING"),
+
+		strictContentType: envBool("STRICT_CONTENT_TYPE", false),
+		homePage:          envHomePage("HOME_PAGE"),
+
+		maxBatchSize: envInt("MAX_BATCH_SIZE", 500),
+		eventLogSize: envInt("EVENT_LOG_SIZE", 100),
+
+		defaultHideCompleted: envBool("DEFAULT_HIDE_COMPLETED", false),
+		lenientDecode:        envBool("LENIENT_DECODE", false),
+
+		maxTags:            envPositiveInt("MAX_TAGS_PER_TODO", 20),
+		maxAttachments:     envPositiveInt("MAX_ATTACHMENTS_PER_TODO", 10),
+		maxMetadataEntries: envPositiveInt("MAX_METADATA_ENTRIES", 20),
+		maxBodyBytes:       int64(envPositiveInt("MAX_BODY_BYTES", 8<<20)),
+	}
+}
+
+// envBasePath reads a URL path prefix from the environment, normalized to a
+// leading and no trailing slash; "" and "/" mean no prefix.
+func envBasePath(key string) string {
+	v := strings.Trim(strings.TrimSpace(os.Getenv(key)), "/")
+	if v == "" {
+		return ""
+	}
+	return "/" + v
+}
+
+// envNaming reads the JSON key style from the environment, falling back to
+// camelCase when unset or invalid.
+func envNaming(key string) string {
+	switch v := os.Getenv(key); v {
+	case "", namingCamel:
+		return namingCamel
+	case namingSnake:
+		return namingSnake
+	default:
+		log.Printf("Invalid %s=%q, using %s", key, v, namingCamel)
+		return namingCamel
+	}
+}
+
+// envHomePage reads the home page kind from the environment, falling back
+// to the Vue app when unset or invalid.
+func envHomePage(key string) string {
+	switch v := os.Getenv(key); v {
+	case "", homePageApp:
+		return homePageApp
+	case homePageServer:
+		return homePageServer
+	default:
+		log.Printf("Invalid %s=%q, using %s", key, v, homePageApp)
+		return homePageApp
+	}
+}
+
+// envList reads a comma separated list from the environment, falling back
+// to def when unset.
+func envList(key string, def []string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	list := []string{}
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// envDuration reads a Go duration (e.g. "90m") from the environment,
+// falling back to def when unset or invalid.
+func envDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Printf("Invalid %s=%q, using %s", key, v, def)
+		return def
+	}
+	return d
+}
+
+// envInt reads a non-negative integer from the environment, falling back to
+// def when unset or invalid.
+func envInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Printf("Invalid %s=%q, using %d", key, v, def)
+		return def
+	}
+	return n
+}
+
+// envPositiveInt is envInt for settings where 0 makes no sense, such as
+// caps that would otherwise forbid everything.
+func envPositiveInt(key string, def int) int {
+	n := envInt(key, def)
+	if n == 0 {
+		log.Printf("Invalid %s=0, using %d", key, def)
+		return def
+	}
+	return n
+}
+
+// envBool reads a boolean from the environment, falling back to def when
+// unset or invalid.
+func envBool(key string, def bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("Invalid %s=%q, using %t", key, v, def)
+		return def
+	}
+	return b
+}
+
+// envMilliseconds reads a duration given in milliseconds from the
+// environment, falling back to def when unset or invalid.
+func envMilliseconds(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	ms, err := strconv.Atoi(v)
+	if err != nil || ms < 0 {
+		log.Printf("Invalid %s=%q, using %s", key, v, def)
+		return def
+	}
+	return time.Duration(ms) * time.Millisecond
+}
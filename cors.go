@@ -0,0 +1,80 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// corsAllowedMethods are the methods preflights are answered with.
+const corsAllowedMethods = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+
+// checkCORS validates the CORS settings at startup.
+func checkCORS(c config) {
+	for _, origin := range c.corsOrigins {
+		if origin == "*" && c.corsCredentials {
+			log.Printf("level=warn msg=\"CORS_ORIGINS=* with CORS_ALLOW_CREDENTIALS lets any site make credentialed requests\"")
+			continue
+		}
+		if origin != "*" && !strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://") {
+			log.Printf("level=warn msg=\"CORS origin %q has no http(s) scheme and will never match\"", origin)
+		}
+	}
+}
+
+// corsOrigin is the Access-Control-Allow-Origin for origin, or "" when it
+// isn't allowed. With credentials the spec forbids "*", so the request's own
+// origin is reflected instead.
+func corsOrigin(origin string) string {
+	for _, allowed := range cfg.corsOrigins {
+		if allowed == "*" {
+			if cfg.corsCredentials {
+				return origin
+			}
+			return "*"
+		}
+		if strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// corsHandler adds the CORS headers for allowed origins and answers their
+// preflights itself.
+func corsHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || len(cfg.corsOrigins) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		allow := corsOrigin(origin)
+		if allow == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", allow)
+		if cfg.corsCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+			if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.corsMaxAge.Seconds())))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if len(cfg.corsExposedHeaders) > 0 {
+			w.Header().Set("Access-Control-Expose-Headers", strings.Join(cfg.corsExposedHeaders, ", "))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
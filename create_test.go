@@ -0,0 +1,75 @@
+package main
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"testing"
+)
+
+func TestTodoURL(t *testing.T) {
+	defer func(base string) { cfg.basePath = base }(cfg.basePath)
+	id := bson.ObjectIdHex("5f1d7a3e9b1e8a3c4d2f0a11")
+
+	cfg.basePath = ""
+	if got, want := todoURL(id), "/todo/5f1d7a3e9b1e8a3c4d2f0a11"; got != want {
+		t.Errorf("todoURL = %q, want %q", got, want)
+	}
+	cfg.basePath = "/api"
+	if got, want := todoURL(id), "/api/todo/5f1d7a3e9b1e8a3c4d2f0a11"; got != want {
+		t.Errorf("todoURL under BASE_PATH = %q, want %q", got, want)
+	}
+}
+
+func TestCreateSetsLocation(t *testing.T) {
+	testDB(t)
+	defer func(base string) { cfg.basePath = base }(cfg.basePath)
+	cfg.basePath = "/api"
+
+	w := serve(todoHandler(), http.MethodPost, "/", `{"title":"Ship it"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST = %d %s, want 201", w.Code, w.Body)
+	}
+	var resp struct {
+		Data todo `json:"data"`
+		Meta struct {
+			Links struct {
+				Self string `json:"self"`
+			} `json:"links"`
+		} `json:"meta"`
+	}
+	decodeBody(t, w, &resp)
+
+	want := "/api/todo/" + resp.Data.ID
+	if got := w.Header().Get("Location"); got != want {
+		t.Errorf("Location = %q, want %q", got, want)
+	}
+	if resp.Meta.Links.Self != want {
+		t.Errorf("meta.links.self = %q, want %q", resp.Meta.Links.Self, want)
+	}
+	if tm := storedTodo(t, bson.ObjectIdHex(resp.Data.ID)); tm.Title != "Ship it" {
+		t.Errorf("the Location points at %q, want the created todo", tm.Title)
+	}
+}
+
+func TestCreateWithClientID(t *testing.T) {
+	testDB(t)
+	h := todoHandler()
+	id := bson.NewObjectId()
+	body := `{"id":"` + id.Hex() + `","title":"Ship it"}`
+
+	w := serve(h, http.MethodPost, "/", body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST = %d %s, want 201", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Location"); got != todoURL(id) {
+		t.Errorf("Location = %q, want %q", got, todoURL(id))
+	}
+
+	w = serve(h, http.MethodPost, "/", `{"id":"`+id.Hex()+`","title":"Something else"}`)
+	if w.Code != http.StatusConflict {
+		t.Errorf("reused id = %d %s, want 409", w.Code, w.Body)
+	}
+	if tm := storedTodo(t, id); tm.Title != "Ship it" {
+		t.Errorf("the conflicting create overwrote the todo: %q", tm.Title)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Mongo server error codes mapped to their own statuses.
+const (
+	mongoDocumentValidationFailure int = 121
+	mongoWriteConcernFailed        int = 64
+)
+
+// dbErrorStatus is the status of a failed DB operation: 409 for a duplicate
+// key, 422 for a document Mongo's validator rejected, 503 while Mongo
+// can't be reached or can't confirm a write, and 500 for the rest.
+func dbErrorStatus(err error) int {
+	if mgo.IsDup(err) {
+		return http.StatusConflict
+	}
+
+	code := 0
+	switch e := err.(type) {
+	case *mgo.LastError:
+		if e.WTimeout {
+			return http.StatusServiceUnavailable
+		}
+		code = e.Code
+	case *mgo.QueryError:
+		code = e.Code
+	}
+	switch code {
+	case mongoDocumentValidationFailure:
+		return http.StatusUnprocessableEntity
+	case mongoWriteConcernFailed:
+		return http.StatusServiceUnavailable
+	}
+
+	if _, ok := err.(net.Error); ok || err == io.EOF || strings.Contains(err.Error(), "no reachable servers") || strings.Contains(err.Error(), "Closed explicitly") {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// renderDBError answers a failed DB operation with the status matching err
+// and message. The raw error stays in the log, since it can carry query
+// details the client has no business seeing.
+func renderDBError(w http.ResponseWriter, message string, err error) {
+	status := dbErrorStatus(err)
+	log.Printf("level=error msg=%q status=%d error=%q", message, status, err)
+
+	resp := renderer.M{
+		"error": message,
+	}
+	switch status {
+	case http.StatusConflict:
+		resp["reason"] = "A TODO with the same unique value already exists"
+	case http.StatusServiceUnavailable:
+		resp["reason"] = "The database is unavailable, please retry later"
+	}
+	if err := rndr.JSON(w, status, resp); err != nil {
+		renderFailed(err)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"github.com/go-chi/chi"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// event is one mutation kept in the in-memory event log.
+type event struct {
+	At     time.Time `json:"at"`
+	Op     string    `json:"op"`
+	ID     string    `json:"id,omitempty"`
+	Status int       `json:"status"`
+}
+
+// eventLog is a fixed-size ring of the latest mutations, for debugging what
+// just happened without a persistent history. It's lost on restart.
+type eventLog struct {
+	mu   sync.Mutex
+	ring []event
+	next int
+	full bool
+}
+
+// events is nil when EVENT_LOG_SIZE is 0.
+var events *eventLog
+
+func newEventLog(size int) *eventLog {
+	return &eventLog{ring: make([]event, size)}
+}
+
+func (l *eventLog) add(e event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ring[l.next] = e
+	l.next = (l.next + 1) % len(l.ring)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// recent returns the logged events, newest first.
+func (l *eventLog) recent() []event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := l.next
+	if l.full {
+		n = len(l.ring)
+	}
+	recent := make([]event, 0, n)
+	for i := 1; i <= n; i++ {
+		recent = append(recent, l.ring[(l.next-i+len(l.ring))%len(l.ring)])
+	}
+	return recent
+}
+
+// statusWriter remembers the status of the response it passes on.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+// recordEvents logs every request that may change a todo, with the route it
+// matched and the status it got, failures included.
+func recordEvents(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if events == nil || readOnly(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		e := event{At: time.Now().UTC(), Op: r.Method + " " + r.URL.Path, Status: sw.status}
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			if pattern := rctx.RoutePattern(); pattern != "" {
+				e.Op = r.Method + " " + pattern
+			}
+			e.ID = rctx.URLParam("id")
+		}
+		events.add(e)
+	})
+}
+
+// fetchRecentEvents renders the event log, newest first.
+func fetchRecentEvents(w http.ResponseWriter, r *http.Request) {
+	recent := []event{}
+	if events != nil {
+		recent = events.recent()
+	}
+	respondOK(w, http.StatusOK, recent, nil)
+}
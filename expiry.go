@@ -0,0 +1,50 @@
+package main
+
+import (
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"time"
+)
+
+// Completed todos expire through a Mongo TTL index on expireAt, which is set
+// to completion time + cfg.completedTTL and removed again on uncompletion.
+// Mongo's TTL monitor only runs about once a minute, so an expired todo can
+// linger for a while before it's actually deleted.
+
+// expiryIndex is the TTL index behind COMPLETED_TTL. mgo only sends
+// expireAfterSeconds when it's positive, so documents go one second after
+// their expireAt rather than exactly at it.
+var expiryIndex = mgo.Index{
+	Key:         []string{"expireAt"},
+	Name:        "todo_expire",
+	ExpireAfter: time.Second,
+}
+
+// expireAt is the expiry of a todo created with the given completion, or nil
+// when it shouldn't expire.
+func expireAt(completed bool) *time.Time {
+	if !completed || cfg.completedTTL == 0 {
+		return nil
+	}
+	t := time.Now().UTC().Add(cfg.completedTTL)
+	return &t
+}
+
+// setExpiry adds the expireAt change matching completed to an update. Like
+// completedAt, $min keeps the original expiry when an already completed todo
+// is completed again.
+func setExpiry(update bson.M, completed bool) {
+	if cfg.completedTTL == 0 {
+		return
+	}
+	if completed {
+		minUpdate(update)["expireAt"] = *expireAt(true)
+		return
+	}
+	unset, ok := update["$unset"].(bson.M)
+	if !ok {
+		unset = bson.M{}
+		update["$unset"] = unset
+	}
+	unset["expireAt"] = ""
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Completing an already completed todo again must not push back when it
+// expires.
+func TestRecompletingKeepsExpiry(t *testing.T) {
+	testDB(t)
+	defer func(ttl time.Duration) { cfg.completedTTL = ttl }(cfg.completedTTL)
+	cfg.completedTTL = time.Hour
+
+	h := todoHandler()
+	completed := time.Now().UTC().Add(-30 * time.Minute).Truncate(time.Millisecond)
+	expires := completed.Add(cfg.completedTTL)
+	id := insertTodo(t, todoModel{Title: "Ship it", Completed: true, CompletedAt: &completed, ExpireAt: &expires})
+
+	writes := []struct {
+		method, path, body string
+	}{
+		{http.MethodPost, "/complete", `{"ids":["` + id.Hex() + `"],"completed":true}`},
+		{http.MethodPatch, "/" + id.Hex(), `{"completed":true}`},
+	}
+	for _, wr := range writes {
+		if w := serve(h, wr.method, wr.path, wr.body); w.Code != http.StatusOK {
+			t.Fatalf("%s %s = %d %s, want 200", wr.method, wr.path, w.Code, w.Body)
+		}
+		tm := storedTodo(t, id)
+		if tm.ExpireAt == nil || !tm.ExpireAt.Equal(expires) {
+			t.Errorf("expireAt after %s %s = %v, want %v", wr.method, wr.path, tm.ExpireAt, expires)
+		}
+		if tm.CompletedAt == nil || !tm.CompletedAt.Equal(completed) {
+			t.Errorf("completedAt after %s %s = %v, want %v", wr.method, wr.path, tm.CompletedAt, completed)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"github.com/go-chi/chi"
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportColumns are the CSV columns of GET /todo/export?format=csv.
+var exportColumns = []string{"id", "title", "description", "completed", "assignee", "tags", "estimateMinutes", "priority", "dueDate", "createdAt", "completedAt"}
+
+// exportTodos downloads every todo matching the usual list filters as a
+// JSON array or a CSV file, in list order. It's written straight from
+// the cursor, gzipped when the client accepts it, so memory stays flat
+// however large the collection. The route sits outside REQUEST_TIMEOUT,
+// which would cut a long download short, but the server's write timeout
+// still bounds it.
+//
+// As with the list stream, a failure once the download has started can't
+// change the status, so the body is cut short, leaving an invalid file (and
+// an unterminated gzip stream) rather than a silently truncated one.
+func exportTodos(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "Invalid format " + format + ", expected json or csv",
+		})
+		return
+	}
+	loc, ok := parseTimezone(w, r)
+	if !ok {
+		return
+	}
+	filter, err := todoFilter(r)
+	if err != nil {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	iter := db.C(collectionName).Find(filter).Sort(listOrder...).Iter()
+	writeExport(w, r, iter, format, loc)
+}
+
+// todoIter is the part of *mgo.Iter an export reads from.
+type todoIter interface {
+	Next(result interface{}) bool
+	Close() error
+}
+
+// writeExport writes the export in format from iter, which it closes. A
+// cursor that fails before its first todo still gets a proper error
+// response.
+func writeExport(w http.ResponseWriter, r *http.Request, iter todoIter, format string, loc *time.Location) {
+	// Only the JSON keys are renamed; the CSV columns keep their names.
+	rename := streamedNaming(r)
+	var tm todoModel
+	more := iter.Next(&tm)
+	if !more {
+		if err := iter.Close(); err != nil {
+			renderDBError(w, "Failed to export TODOs", err)
+			return
+		}
+	}
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=UTF-8")
+	} else {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="todos.`+format+`"`)
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	var out io.Writer = w
+	var gz *gzip.Writer
+	if acceptsGzip(r) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz = gzip.NewWriter(w)
+		out = gz
+	}
+	w.WriteHeader(http.StatusOK)
+
+	var write func(todo) error
+	var finish func() error
+	if format == "csv" {
+		cw := csv.NewWriter(out)
+		if err := cw.Write(exportColumns); err != nil {
+			iter.Close()
+			return
+		}
+		write = func(t todo) error {
+			return cw.Write(exportRecord(t))
+		}
+		finish = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	} else {
+		if _, err := io.WriteString(out, "["); err != nil {
+			iter.Close()
+			return
+		}
+		first := true
+		write = func(t todo) error {
+			if !first {
+				if _, err := io.WriteString(out, ","); err != nil {
+					return err
+				}
+			}
+			first = false
+			return encodeNamed(out, t, rename)
+		}
+		finish = func() error {
+			_, err := io.WriteString(out, "]")
+			return err
+		}
+	}
+
+	for more {
+		if err := write(toTodo(tm, loc)); err != nil {
+			iter.Close()
+			return
+		}
+		tm = todoModel{}
+		more = iter.Next(&tm)
+	}
+	if err := iter.Close(); err != nil {
+		log.Println("Failed to export todos:", err)
+		return
+	}
+	if err := finish(); err != nil {
+		return
+	}
+	if gz != nil {
+		gz.Close()
+	}
+}
+
+// exportRecord is the CSV row of t; tags are joined with ";".
+func exportRecord(t todo) []string {
+	return []string{
+		t.ID,
+		t.Title,
+		t.Description,
+		strconv.FormatBool(t.Completed),
+		t.Assignee,
+		strings.Join(t.Tags, ";"),
+		strconv.Itoa(t.EstimateMinutes),
+		t.Priority,
+		formatOptionalTime(t.DueDate),
+		t.CreatedAt.Format(time.RFC3339),
+		formatOptionalTime(t.CompletedAt),
+	}
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// acceptsGzip reports whether the request's Accept-Encoding allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding := strings.TrimSpace(part)
+		if i := strings.Index(coding, ";"); i >= 0 {
+			if q := strings.TrimSpace(coding[i+1:]); q == "q=0" || q == "q=0.0" {
+				continue
+			}
+			coding = strings.TrimSpace(coding[:i])
+		}
+		if coding == "gzip" || coding == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// todoExport is a todo with everything kept about it outside its document.
+type todoExport struct {
+	todo
+	Comments []comment `json:"comments"`
+}
+
+// exportSingleTodo downloads one todo as a JSON file, including its
+// comments, which the regular GET leaves out. It's meant for attaching a
+// todo's full state to a support ticket.
+func exportSingleTodo(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+
+	if !bson.IsObjectIdHex(id) {
+		if err1 := rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "Invalid URL request",
+		}); err1 != nil {
+			renderFailed(err1)
+			return
+		}
+		return
+	}
+
+	loc, ok := parseTimezone(w, r)
+	if !ok {
+		return
+	}
+
+	var tm todoModel
+	selector := activeTodo(bson.ObjectIdHex(id))
+	if err := timeQuery(r.Context(), "findOne", selector, func() error {
+		return db.C(collectionName).Find(selector).One(&tm)
+	}); err != nil {
+		if err == mgo.ErrNotFound {
+			renderMissingTodo(w, r, bson.ObjectIdHex(id))
+			return
+		}
+		renderDBError(w, "Failed to export TODO", err)
+		return
+	}
+
+	comments := []commentModel{}
+	filter := bson.M{"todoId": tm.ID}
+	if err := timeQuery(r.Context(), "find", filter, func() error {
+		return db.C(commentsName).Find(filter).Sort("createdAt", "_id").All(&comments)
+	}); err != nil {
+		renderDBError(w, "Failed to export TODO", err)
+		return
+	}
+
+	export := todoExport{todo: toTodo(tm, loc), Comments: []comment{}}
+	for _, c := range comments {
+		export.Comments = append(export.Comments, toComment(c, loc))
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="todo-`+id+`.json"`)
+	if err1 := rndr.JSON(w, http.StatusOK, export); err1 != nil {
+		renderFailed(err1)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeIter is a cursor over n generated todos that fails with err once it
+// has handed them all out.
+type fakeIter struct {
+	n, next int
+	err     error
+	// onNext, when set, runs before each document is handed out.
+	onNext func(i int)
+}
+
+func (it *fakeIter) Next(result interface{}) bool {
+	if it.next >= it.n {
+		return false
+	}
+	if it.onNext != nil {
+		it.onNext(it.next)
+	}
+	*result.(*todoModel) = todoModel{ID: bson.NewObjectId(), Title: "todo", Position: it.next}
+	it.next++
+	return true
+}
+
+func (it *fakeIter) Close() error {
+	return it.err
+}
+
+func exportRequest(gzipped bool) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/todo/export", nil)
+	if gzipped {
+		r.Header.Set("Accept-Encoding", "gzip, deflate")
+	}
+	return r
+}
+
+func TestExportLargeCursorGzipped(t *testing.T) {
+	const n = 50000
+	w := httptest.NewRecorder()
+	writeExport(w, exportRequest(true), &fakeIter{n: n}, "json", time.UTC)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("Content-Encoding = %q, want gzip", got)
+	}
+	if got, want := w.Header().Get("Content-Disposition"), `attachment; filename="todos.json"`; got != want {
+		t.Errorf("Content-Disposition = %q, want %q", got, want)
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var todos []todo
+	if err := json.NewDecoder(zr).Decode(&todos); err != nil {
+		t.Fatalf("the export isn't a valid gzipped JSON array: %s", err)
+	}
+	if len(todos) != n || todos[n-1].Position != n-1 {
+		t.Errorf("exported %d todos, want %d in cursor order", len(todos), n)
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeExport(w, exportRequest(false), &fakeIter{n: 3}, "csv", time.UTC)
+
+	if got := w.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q without Accept-Encoding", got)
+	}
+	if got, want := w.Header().Get("Content-Disposition"), `attachment; filename="todos.csv"`; got != want {
+		t.Errorf("Content-Disposition = %q, want %q", got, want)
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 || len(records[0]) != len(exportColumns) || records[1][1] != "todo" {
+		t.Errorf("CSV = %v, want a header and 3 rows", records)
+	}
+}
+
+// A cursor that fails before any todo is an error response; one that fails
+// midway leaves a gzip stream that doesn't decode.
+func TestExportCursorFailure(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeExport(w, exportRequest(true), &fakeIter{err: errors.New("no reachable servers")}, "json", time.UTC)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Content-Disposition") != "" {
+		t.Errorf("failure before the first todo = %d %v, want a plain 503", w.Code, w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	writeExport(w, exportRequest(true), &fakeIter{n: 10, err: errors.New("cursor not found")}, "json", time.UTC)
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var todos []todo
+	if err := json.NewDecoder(zr).Decode(&todos); err == nil {
+		t.Error("an export cut short by the cursor decodes as a complete file")
+	}
+}
+
+// With snake_case naming the export is still streamed: fieldNaming passes
+// it through and each todo is renamed on its own.
+func TestExportSnakeNamingStreams(t *testing.T) {
+	const n = 20000
+	w := httptest.NewRecorder()
+	iter := &fakeIter{n: n, onNext: func(i int) {
+		if i == n/2 && w.Body.Len() < n/2*len(`{"title":"todo"}`) {
+			t.Errorf("only %d bytes written after %d todos, the export is buffered", w.Body.Len(), i)
+		}
+	}}
+	h := fieldNaming(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeExport(w, r, iter, "json", time.UTC)
+	}))
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todo/export?naming=snake", nil))
+
+	if got, want := w.Header().Get("Content-Disposition"), `attachment; filename="todos.json"`; got != want {
+		t.Errorf("Content-Disposition = %q, want %q", got, want)
+	}
+	var todos []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &todos); err != nil {
+		t.Fatalf("the export isn't a valid JSON array: %s", err)
+	}
+	if len(todos) != n {
+		t.Fatalf("exported %d todos, want %d", len(todos), n)
+	}
+	if _, ok := todos[0]["created_at"]; !ok {
+		t.Errorf("todo keys = %v, want snake_case", todos[0])
+	}
+	if _, ok := todos[0]["createdAt"]; ok {
+		t.Errorf("todo keys = %v, still camelCase", todos[0])
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"strings"
+)
+
+// todoPage is the single document of the $facet list pipeline.
+type todoPage struct {
+	Data  []todoModel `bson:"data"`
+	Total []struct {
+		N int `bson:"n"`
+	} `bson:"total"`
+}
+
+// sortStage turns a Query.Sort style field ("-title") into a $sort stage,
+// which like every list keeps pinned todos first and breaks ties on _id.
+func sortStage(sortBy string) bson.M {
+	order := bson.D{{Name: "pinned", Value: -1}}
+	if strings.HasPrefix(sortBy, "-") {
+		order = append(order, bson.DocElem{Name: strings.TrimPrefix(sortBy, "-"), Value: -1})
+	} else {
+		order = append(order, bson.DocElem{Name: sortBy, Value: 1})
+	}
+	return bson.M{"$sort": append(order, bson.DocElem{Name: "_id", Value: 1})}
+}
+
+// renderFacetPage renders one page of the todos matching filter along with
+// their total, both from one $facet aggregation so the count can't drift
+// from the page. The whole page comes back as a single document, bounded
+// by the 16MB document limit, so it's only used for limited pages.
+func renderFacetPage(w http.ResponseWriter, r *http.Request, filter bson.M, sortBy, view string, limit, offset int, convert func(todoModel) interface{}) {
+	data := []bson.M{sortStage(sortBy)}
+	if offset > 0 {
+		data = append(data, bson.M{"$skip": offset})
+	}
+	data = append(data, bson.M{"$limit": limit})
+	if fields := viewFields(view); fields != nil {
+		data = append(data, bson.M{"$project": fields})
+	}
+	pipeline := []bson.M{
+		{"$match": filter},
+		{"$facet": bson.M{
+			"data":  data,
+			"total": []bson.M{{"$count": "n"}},
+		}},
+	}
+
+	var page todoPage
+	if err := timeQuery(r.Context(), "aggregate", filter, func() error {
+		return db.C(collectionName).Pipe(pipeline).One(&page)
+	}); err != nil {
+		renderDBError(w, "Failed to fetch todo", err)
+		return
+	}
+
+	// $count emits nothing at all for an empty match.
+	total := 0
+	if len(page.Total) > 0 {
+		total = page.Total[0].N
+	}
+	todoList := []interface{}{}
+	for _, t := range page.Data {
+		todoList = append(todoList, convert(t))
+	}
+
+	setPaginationHeaders(w, r, total, limit, offset)
+	respondOK(w, http.StatusOK, todoList, pageMeta(total, limit, offset))
+}
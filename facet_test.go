@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSortStageBreaksTiesOnID(t *testing.T) {
+	tests := []struct {
+		sortBy string
+		want   bson.D
+	}{
+		{"createdAt", bson.D{{Name: "pinned", Value: -1}, {Name: "createdAt", Value: 1}, {Name: "_id", Value: 1}}},
+		{"-createdAt", bson.D{{Name: "pinned", Value: -1}, {Name: "createdAt", Value: -1}, {Name: "_id", Value: 1}}},
+	}
+	for _, tt := range tests {
+		if got := sortStage(tt.sortBy)["$sort"]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sortStage(%q) = %v, want %v", tt.sortBy, got, tt.want)
+		}
+	}
+}
+
+// Todos created in one batch share their createdAt; paging through them
+// must still return each exactly once, in the same order every time.
+func TestPagesWithIdenticalCreatedAt(t *testing.T) {
+	testDB(t)
+	created := time.Now().UTC().Truncate(time.Millisecond)
+	want := []string{}
+	for i := 0; i < 7; i++ {
+		want = append(want, insertTodo(t, todoModel{Title: fmt.Sprint("todo ", i), CreatedAt: created}).Hex())
+	}
+
+	h := todoHandler()
+	for _, path := range []string{"/?sort=createdAt&limit=%d&offset=%d", "/?sort=-createdAt&limit=%d&offset=%d"} {
+		got := []string{}
+		for offset := 0; offset < len(want); offset += 3 {
+			w := serve(h, http.MethodGet, fmt.Sprintf(path, 3, offset), "")
+			var resp struct {
+				Data []todo `json:"data"`
+			}
+			decodeBody(t, w, &resp)
+			for _, td := range resp.Data {
+				got = append(got, td.ID)
+			}
+		}
+		// ObjectIds generated in a row sort in creation order.
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s pages = %v, want %v", path, got, want)
+		}
+	}
+}
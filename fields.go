@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+)
+
+// queryField describes a todo field as list query params and search
+// expressions see it: the stored field it maps to, the kind of its values
+// and what clients may do with it.
+type queryField struct {
+	bson       string
+	kind       fieldKind
+	filterable bool
+	searchable bool
+	sortable   bool
+	indexed    bool
+}
+
+// fieldKind tells how a search expression value is converted to the stored
+// value.
+type fieldKind int
+
+const (
+	kindString fieldKind = iota
+	kindBool
+	kindInt
+	kindPriority
+	kindTag
+	kindTime
+)
+
+// queryFields is the one list of todo fields clients can name in ?sort= or
+// as a filter param, keyed by their public name. A field that's missing
+// here, or lacks the flag, is rejected rather than queried, which keeps
+// clients off arbitrary stored fields.
+var queryFields = map[string]queryField{
+	"title":       {bson: "title", kind: kindString, searchable: true, sortable: true},
+	"description": {bson: "description", kind: kindString},
+	"completed":   {bson: "completed", kind: kindBool, filterable: true, searchable: true},
+	"assignee":    {bson: "assignee", kind: kindString, filterable: true, searchable: true},
+	"tag":         {bson: "tags", kind: kindTag, filterable: true, searchable: true},
+	"priority":    {bson: "priority", kind: kindPriority, filterable: true, searchable: true, sortable: true},
+	"estimate":    {bson: "estimateMinutes", kind: kindInt, searchable: true, sortable: true},
+	"dueDate":     {bson: "dueDate", kind: kindTime, searchable: true, sortable: true},
+	"position":    {bson: "position", kind: kindInt, sortable: true, indexed: true},
+	"sortKey":     {bson: "sortKey", kind: kindString, sortable: true},
+	"createdAt":   {bson: "createdAt", kind: kindTime, searchable: true, sortable: true, indexed: true},
+}
+
+// checkFilterParams rejects query params naming a todo field that can't be
+// filtered on, such as ?description=, instead of silently ignoring them.
+func checkFilterParams(query url.Values) error {
+	for name := range query {
+		if f, ok := queryFields[name]; ok && !f.filterable {
+			return errors.New("Cannot filter by " + name)
+		}
+	}
+	return nil
+}
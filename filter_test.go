@@ -0,0 +1,50 @@
+package main
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestCompletedFilter(t *testing.T) {
+	defer func(hide bool) { cfg.defaultHideCompleted = hide }(cfg.defaultHideCompleted)
+
+	open, done, both := false, true, interface{}(nil)
+	tests := []struct {
+		query string
+		hide  bool
+		want  interface{}
+	}{
+		{"", false, both},
+		{"", true, open},
+		{"?includeCompleted=true", false, both},
+		{"?includeCompleted=true", true, both},
+		{"?includeCompleted=false", false, open},
+		{"?includeCompleted=false", true, open},
+		{"?completed=true", false, done},
+		{"?completed=true", true, done},
+		{"?completed=false", false, open},
+		{"?completed=true&includeCompleted=false", true, done},
+		{"?completed=false&includeCompleted=true", false, open},
+		{"?state=completed&includeCompleted=false", true, both},
+		{"?state=all&completed=false", true, both},
+	}
+	for _, tt := range tests {
+		cfg.defaultHideCompleted = tt.hide
+		filter := bson.M{}
+		if err := completedFilter(httptest.NewRequest("GET", "/todo"+tt.query, nil), filter); err != nil {
+			t.Errorf("%s (hide %v): %s", tt.query, tt.hide, err)
+			continue
+		}
+		if got := filter["completed"]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s (hide %v): completed = %v, want %v", tt.query, tt.hide, filter["completed"], tt.want)
+		}
+	}
+
+	for _, query := range []string{"?completed=yes", "?includeCompleted=maybe"} {
+		if err := completedFilter(httptest.NewRequest("GET", "/todo"+query, nil), bson.M{}); err == nil {
+			t.Errorf("%s: no error", query)
+		}
+	}
+}
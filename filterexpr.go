@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxFilterDepth and maxFilterConditions bound a search expression, so
+	// a request can't make Mongo evaluate an arbitrarily large query.
+	maxFilterDepth      int = 4
+	maxFilterConditions int = 32
+)
+
+// filterNode is one node of a POST /todo/search expression: either an
+// "and" or an "or" of child nodes, or a single field condition.
+type filterNode struct {
+	And   []filterNode    `json:"and"`
+	Or    []filterNode    `json:"or"`
+	Field string          `json:"field"`
+	Op    string          `json:"op"`
+	Value json.RawMessage `json:"value"`
+}
+
+type searchRequest struct {
+	Filter *filterNode `json:"filter"`
+}
+
+// filterOps maps the operators of a condition to Mongo's. contains is a
+// case-insensitive substring match on string fields and exists takes a
+// boolean; the others compare with the converted value.
+var filterOps = map[string]string{
+	"eq":       "$eq",
+	"ne":       "$ne",
+	"in":       "$in",
+	"nin":      "$nin",
+	"lt":       "$lt",
+	"lte":      "$lte",
+	"gt":       "$gt",
+	"gte":      "$gte",
+	"contains": "$regex",
+	"exists":   "$exists",
+}
+
+// searchTodos lists the todos matching a JSON filter expression, on top of
+// the usual list query params, in the same envelope and pages as GET /todo.
+// Only the searchable fields of queryFields and the operators of filterOps
+// are accepted, and every value is converted to the field's type, so no
+// part of the body reaches Mongo as written.
+func searchTodos(w http.ResponseWriter, r *http.Request) {
+	var req searchRequest
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+	if err := d.Decode(&req); err != nil {
+		renderBadBody(w, err)
+		return
+	}
+	if req.Filter == nil {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "Missing filter",
+		})
+		return
+	}
+
+	loc, ok := parseTimezone(w, r)
+	if !ok {
+		return
+	}
+	filter, err := todoFilter(r)
+	if err != nil {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	conditions := 0
+	expr, err := filterQuery(*req.Filter, "/filter", 1, &conditions)
+	if err != nil {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": err.Error(),
+		})
+		return
+	}
+	filter["$and"] = []bson.M{expr}
+
+	listTodos(w, r, filter, loc)
+}
+
+// filterQuery translates node into a Mongo query. path is its JSON Pointer
+// in the request, for error messages.
+func filterQuery(node filterNode, path string, depth int, conditions *int) (bson.M, error) {
+	if depth > maxFilterDepth {
+		return nil, fmt.Errorf("%s: filters cannot be nested more than %d levels deep", path, maxFilterDepth)
+	}
+
+	kinds := 0
+	for _, set := range []bool{node.And != nil, node.Or != nil, node.Field != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return nil, fmt.Errorf("%s: a filter must have exactly one of and, or, field", path)
+	}
+
+	if node.Field == "" {
+		op, children, name := "$and", node.And, "and"
+		if node.Or != nil {
+			op, children, name = "$or", node.Or, "or"
+		}
+		if len(children) == 0 {
+			return nil, fmt.Errorf("%s/%s: cannot be empty", path, name)
+		}
+		parts := []bson.M{}
+		for i, child := range children {
+			part, err := filterQuery(child, fmt.Sprintf("%s/%s/%d", path, name, i), depth+1, conditions)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, part)
+		}
+		return bson.M{op: parts}, nil
+	}
+
+	if *conditions++; *conditions > maxFilterConditions {
+		return nil, fmt.Errorf("a filter cannot have more than %d conditions", maxFilterConditions)
+	}
+	f, ok := queryFields[node.Field]
+	if !ok || !f.searchable {
+		return nil, fmt.Errorf("%s/field: cannot search by %s", path, node.Field)
+	}
+	op, ok := filterOps[node.Op]
+	if !ok {
+		return nil, fmt.Errorf("%s/op: unknown operator %q", path, node.Op)
+	}
+	if len(node.Value) == 0 {
+		return nil, fmt.Errorf("%s/value: missing value", path)
+	}
+
+	var value interface{}
+	var err error
+	switch node.Op {
+	case "exists":
+		var b bool
+		if err := json.Unmarshal(node.Value, &b); err != nil {
+			return nil, fmt.Errorf("%s/value: exists takes true or false", path)
+		}
+		value = b
+	case "contains":
+		if f.kind != kindString {
+			return nil, fmt.Errorf("%s/op: contains only applies to text fields", path)
+		}
+		var s string
+		if err := json.Unmarshal(node.Value, &s); err != nil || s == "" {
+			return nil, fmt.Errorf("%s/value: contains takes a non-empty string", path)
+		}
+		return bson.M{f.bson: bson.M{"$regex": regexp.QuoteMeta(s), "$options": "i"}}, nil
+	case "in", "nin":
+		var raw []json.RawMessage
+		if err := json.Unmarshal(node.Value, &raw); err != nil || len(raw) == 0 {
+			return nil, fmt.Errorf("%s/value: %s takes a non-empty array", path, node.Op)
+		}
+		values := []interface{}{}
+		for i, v := range raw {
+			converted, err := filterValue(f, v)
+			if err != nil {
+				return nil, fmt.Errorf("%s/value/%d: %s", path, i, err)
+			}
+			values = append(values, converted)
+		}
+		value = values
+	case "lt", "lte", "gt", "gte":
+		if f.kind == kindBool || f.kind == kindTag {
+			return nil, fmt.Errorf("%s/op: %s doesn't apply to %s", path, node.Op, node.Field)
+		}
+		fallthrough
+	default:
+		if value, err = filterValue(f, node.Value); err != nil {
+			return nil, fmt.Errorf("%s/value: %s", path, err)
+		}
+	}
+	return bson.M{f.bson: bson.M{op: value}}, nil
+}
+
+// filterValue converts a condition value to the stored type of f.
+func filterValue(f queryField, raw json.RawMessage) (interface{}, error) {
+	// null matches a missing field, as in Mongo.
+	if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		return nil, nil
+	}
+
+	switch f.kind {
+	case kindBool:
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return nil, errors.New("expected true or false")
+		}
+		return b, nil
+	case kindInt:
+		var n json.Number
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return nil, errors.New("expected an integer")
+		}
+		i, err := strconv.Atoi(n.String())
+		if err != nil {
+			return nil, errors.New("expected an integer")
+		}
+		return i, nil
+	case kindPriority:
+		var s string
+		json.Unmarshal(raw, &s)
+		rank, ok := priorityRanks[s]
+		if !ok || s == "" {
+			return nil, errors.New("expected low, medium or high")
+		}
+		return rank, nil
+	case kindTime:
+		var t time.Time
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return nil, errors.New("expected an RFC 3339 date-time")
+		}
+		return t.UTC(), nil
+	case kindTag:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, errors.New("expected a string")
+		}
+		return normalizeTag(s), nil
+	default:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, errors.New("expected a string")
+		}
+		return s, nil
+	}
+}
@@ -3,18 +3,27 @@ module github.com/ShreyasBN2648/go-todo
 go 1.17
 
 require (
+	github.com/go-chi/chi v1.5.4
+	github.com/microcosm-cc/bluemonday v1.0.20
+	github.com/santhosh-tekuri/jsonschema/v5 v5.1.1
+	github.com/thedevsaddam/renderer v1.2.0
+	github.com/yuin/goldmark v1.4.13
+	gopkg.in/mgo.v2 v2.0.0-20190816093944-a6b53ec6cb22
+)
+
+require (
+	github.com/aymerick/douceur v0.2.0 // indirect
 	github.com/cucumber/gherkin-go/v19 v19.0.3 // indirect
 	github.com/cucumber/godog v0.12.0 // indirect
 	github.com/cucumber/messages-go/v16 v16.0.1 // indirect
-	github.com/go-chi/chi v1.5.4 // indirect
 	github.com/gofrs/uuid v4.0.0+incompatible // indirect
+	github.com/gorilla/css v1.0.0 // indirect
 	github.com/hashicorp/go-immutable-radix v1.3.0 // indirect
 	github.com/hashicorp/go-memdb v1.3.0 // indirect
 	github.com/hashicorp/golang-lru v0.5.4 // indirect
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
 	github.com/spf13/cobra v1.1.1 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
-	github.com/thedevsaddam/renderer v1.2.0 // indirect
-	gopkg.in/mgo.v2 v2.0.0-20190816093944-a6b53ec6cb22 // indirect
+	golang.org/x/net v0.0.0-20220826154423-83b083e8dc8b // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"gopkg.in/mgo.v2/bson"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	homePageApp    string = "app"
+	homePageServer string = "server"
+)
+
+// The templates of the two home pages, relative to the working directory.
+const (
+	appTemplate    string = "static/home.tpl"
+	serverTemplate string = "static/list.tpl"
+)
+
+// homeTodoLimit caps the todos the server-rendered home page lists.
+const homeTodoLimit int = 100
+
+// homePage is the data of serverTemplate.
+type homePage struct {
+	Todos          []todo
+	Error          string
+	MaxTitleLength int
+	CSRFField      string
+	CSRFToken      string
+}
+
+// renderHomePage renders the server-side home page with the open and done
+// todos of the default list. A failing query shows an error on the page
+// itself rather than taking the server down.
+func renderHomePage(w http.ResponseWriter, r *http.Request, status int, message string) {
+	page := homePage{
+		Todos:          []todo{},
+		Error:          message,
+		MaxTitleLength: maxTitleLength,
+		CSRFField:      csrfField,
+		CSRFToken:      csrfToken(w, r),
+	}
+
+	todos := []todoModel{}
+	filter := notDeleted()
+	filter["archived"] = bson.M{"$ne": true}
+	if err := timeQuery(r.Context(), "find", filter, func() error {
+		return db.C(collectionName).Find(filter).Sort(listOrder...).Limit(homeTodoLimit).All(&todos)
+	}); err != nil {
+		log.Printf("level=error msg=\"Failed to fetch todo\" error=%q", err)
+		status = dbErrorStatus(err)
+		page.Error = "The TODOs can't be loaded right now, please retry later."
+	}
+	for _, t := range todos {
+		page.Todos = append(page.Todos, toTodo(t, time.UTC))
+	}
+
+	renderTemplate(w, status, serverTemplate, page)
+}
+
+// checkHomeTemplate stops the server at startup when the template of the
+// configured home page is missing or broken, typically because it was
+// started outside the repository, rather than on the first visit.
+func checkHomeTemplate() {
+	path := appTemplate
+	if cfg.homePage == homePageServer {
+		path = serverTemplate
+	}
+	if _, err := template.ParseFiles(path); err != nil {
+		log.Fatalf("The home page template can't be loaded, start the server from the directory holding static/: %s", err)
+	}
+}
+
+// renderTemplate renders the page at path. The template is parsed on every
+// request, so edits show up without a restart, and fully rendered before
+// anything is sent, so a missing or failing template is answered with a 500
+// instead of a half-written page. The renderer's Template panics on a
+// missing file and sends the status first, which is why it isn't used here.
+func renderTemplate(w http.ResponseWriter, status int, path string, data interface{}) {
+	var buf bytes.Buffer
+	t, err := template.ParseFiles(path)
+	if err == nil {
+		err = t.Execute(&buf, data)
+	}
+	if err != nil {
+		log.Printf("level=error msg=\"Failed to render the home page\" template=%s error=%q", path, err)
+		http.Error(w, "The page is unavailable, please retry later.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	w.WriteHeader(status)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		renderFailed(err)
+	}
+}
+
+// createTodoForm adds a todo from the server-rendered page's form and sends
+// the browser back to the page.
+func createTodoForm(w http.ResponseWriter, r *http.Request) {
+	if cfg.homePage != homePageServer {
+		http.NotFound(w, r)
+		return
+	}
+	if !validCSRF(r) {
+		renderHomePage(w, r, http.StatusForbidden, "The form expired, please try again.")
+		return
+	}
+	if inMaintenance() {
+		renderHomePage(w, r, http.StatusServiceUnavailable, "The service is under maintenance, changes are disabled for now.")
+		return
+	}
+
+	title, err := validateTitle(r.PostFormValue("title"))
+	if err != nil {
+		renderHomePage(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	position, err := nextPosition(r.Context())
+	if err == nil {
+		now := time.Now().UTC()
+		err = timeQuery(r.Context(), "insert", nil, func() error {
+			return db.C(collectionName).Insert(&todoModel{
+				ID:        bson.NewObjectId(),
+				Title:     title,
+				Tags:      []string{},
+				Position:  position,
+				CreatedAt: now,
+			})
+		})
+	}
+	if err != nil {
+		log.Printf("level=error msg=\"Failed to create TODO\" error=%q", err)
+		renderHomePage(w, r, dbErrorStatus(err), "The TODO couldn't be added, please retry later.")
+		return
+	}
+
+	http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+}
+
+// homeAllowedMethods are the methods the home route answers.
+const homeAllowedMethods = "GET, HEAD, POST, OPTIONS"
+
+// homeHead answers HEAD / with the headers of the home page and no body, so
+// health checkers don't make it render the page or query the todos.
+func homeHead(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+}
+
+// homeOptions lists the methods of the home route.
+func homeOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", homeAllowedMethods)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// errBatchTooLarge stops the decoding of a batch once it has more items
+// than cfg.maxBatchSize allows; renderBadBody answers it with a 413.
+var errBatchTooLarge = errors.New("batch too large")
+
+// batchTooLarge writes a 413 and returns true when a bulk or batch request
+// has more items than cfg.maxBatchSize allows.
+func batchTooLarge(w http.ResponseWriter, n int) bool {
+	if cfg.maxBatchSize == 0 || n <= cfg.maxBatchSize {
+		return false
+	}
+	renderBatchTooLarge(w)
+	return true
+}
+
+func renderBatchTooLarge(w http.ResponseWriter) {
+	if err := rndr.JSON(w, http.StatusRequestEntityTooLarge, renderer.M{
+		"error": fmt.Sprintf("A batch cannot have more than %d items", cfg.maxBatchSize),
+	}); err != nil {
+		renderFailed(err)
+	}
+}
+
+// decodeBatch reads the JSON array body of a bulk request one entry at a
+// time and gives up with a 413 as soon as there's one entry too many, so
+// an oversized batch is neither read nor decoded in full. The entries are
+// left raw for the handler to decode. On failure it writes the error
+// response and returns false.
+func decodeBatch(w http.ResponseWriter, body io.Reader) ([]json.RawMessage, bool) {
+	notArray := func() {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "The body must be a JSON array of TODOs",
+		})
+	}
+	d := json.NewDecoder(body)
+	tok, err := d.Token()
+	if err != nil {
+		renderBadBody(w, err)
+		return nil, false
+	}
+	if tok != json.Delim('[') {
+		notArray()
+		return nil, false
+	}
+	entries := []json.RawMessage{}
+	for d.More() {
+		if batchTooLarge(w, len(entries)+1) {
+			return nil, false
+		}
+		var entry json.RawMessage
+		if err := d.Decode(&entry); err != nil {
+			renderBadBody(w, err)
+			return nil, false
+		}
+		entries = append(entries, entry)
+	}
+	if _, err := d.Token(); err != nil {
+		renderBadBody(w, err)
+		return nil, false
+	}
+	if _, err := d.Token(); err != io.EOF {
+		notArray()
+		return nil, false
+	}
+	return entries, true
+}
+
+// batchIDs is the ids list of a batch request body. It's decoded one id at
+// a time and fails with errBatchTooLarge at the first id past the cap,
+// rather than after decoding them all.
+type batchIDs []string
+
+func (ids *batchIDs) UnmarshalJSON(raw []byte) error {
+	d := json.NewDecoder(bytes.NewReader(raw))
+	tok, err := d.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		*ids = nil
+		return nil
+	}
+	if tok != json.Delim('[') {
+		return errors.New("ids must be an array of strings")
+	}
+	list := batchIDs{}
+	for d.More() {
+		if cfg.maxBatchSize != 0 && len(list) == cfg.maxBatchSize {
+			return errBatchTooLarge
+		}
+		var id string
+		if err := d.Decode(&id); err != nil {
+			return err
+		}
+		list = append(list, id)
+	}
+	*ids = list
+	return nil
+}
+
+// parseIDs parses the todo ids of a batch request. When one is missing,
+// invalid or listed twice it writes the error response and returns false,
+// so a batch is rejected as a whole before anything is written.
+func parseIDs(w http.ResponseWriter, raw []string) ([]bson.ObjectId, bool) {
+	if len(raw) == 0 {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "No TODO ids given",
+		})
+		return nil, false
+	}
+	if batchTooLarge(w, len(raw)) {
+		return nil, false
+	}
+	ids := []bson.ObjectId{}
+	seen := map[bson.ObjectId]bool{}
+	duplicates := []string{}
+	for _, id := range raw {
+		id = strings.TrimSpace(id)
+		if !bson.IsObjectIdHex(id) {
+			rndr.JSON(w, http.StatusBadRequest, renderer.M{
+				"error": "Invalid TODO id " + id,
+			})
+			return nil, false
+		}
+		oid := bson.ObjectIdHex(id)
+		if seen[oid] {
+			duplicates = append(duplicates, oid.Hex())
+			continue
+		}
+		seen[oid] = true
+		ids = append(ids, oid)
+	}
+	if len(duplicates) > 0 {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error":      "The same TODO id is listed more than once",
+			"duplicates": duplicates,
+		})
+		return nil, false
+	}
+	return ids, true
+}
+
+// activeTodos selects the listed todos that aren't in the trash.
+func activeTodos(ids []bson.ObjectId) bson.M {
+	selector := notDeleted()
+	selector["_id"] = bson.M{"$in": ids}
+	return selector
+}
+
+// missingIDs returns which of ids activeTodos doesn't match, for batch
+// responses. On failure it writes the error response and returns false.
+func missingIDs(w http.ResponseWriter, r *http.Request, ids []bson.ObjectId) ([]string, bool) {
+	selector := activeTodos(ids)
+	var found []struct {
+		ID bson.ObjectId `bson:"_id"`
+	}
+	if err := timeQuery(r.Context(), "find", selector, func() error {
+		return db.C(collectionName).Find(selector).Select(bson.M{"_id": 1}).All(&found)
+	}); err != nil {
+		renderDBError(w, "Failed to fetch TODOs", err)
+		return nil, false
+	}
+
+	exists := map[bson.ObjectId]bool{}
+	for _, f := range found {
+		exists[f.ID] = true
+	}
+	missing := []string{}
+	for _, id := range ids {
+		if !exists[id] {
+			missing = append(missing, id.Hex())
+		}
+	}
+	return missing, true
+}
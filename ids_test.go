@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseIDs(t *testing.T) {
+	a, b := "5f1d7a2b9c3e4d5f6a7b8c9d", "5f1d7a2b9c3e4d5f6a7b8c9e"
+	tests := []struct {
+		name       string
+		raw        []string
+		n          int
+		duplicates []interface{}
+	}{
+		{"distinct", []string{a, b}, 2, nil},
+		{"trimmed", []string{" " + a + "\t"}, 1, nil},
+		{"repeated", []string{a, b, a}, 0, []interface{}{a}},
+		{"repeated after trimming", []string{a, " " + a}, 0, []interface{}{a}},
+		{"repeated in upper case", []string{a, "5F1D7A2B9C3E4D5F6A7B8C9D"}, 0, []interface{}{a}},
+		{"repeated twice", []string{a, a, b, b, a}, 0, []interface{}{a, b, a}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ids, ok := parseIDs(w, tt.raw)
+			if tt.duplicates == nil {
+				if !ok || len(ids) != tt.n {
+					t.Fatalf("parseIDs() = %v, %v, want %d ids", ids, ok, tt.n)
+				}
+				return
+			}
+			if ok || w.Code != http.StatusBadRequest {
+				t.Fatalf("parseIDs() ok = %v, status %d, want a 400", ok, w.Code)
+			}
+			var resp struct {
+				Duplicates []interface{} `json:"duplicates"`
+			}
+			decodeBody(t, w, &resp)
+			if !reflect.DeepEqual(resp.Duplicates, tt.duplicates) {
+				t.Errorf("duplicates = %v, want %v", resp.Duplicates, tt.duplicates)
+			}
+		})
+	}
+}
+
+func TestParseIDsRejectsInvalidBatches(t *testing.T) {
+	for _, raw := range [][]string{nil, {}, {"nope"}, {"5f1d7a2b9c3e4d5f6a7b8c9d", ""}} {
+		w := httptest.NewRecorder()
+		if _, ok := parseIDs(w, raw); ok || w.Code != http.StatusBadRequest {
+			t.Errorf("parseIDs(%q) ok = %v, status %d, want a 400", raw, ok, w.Code)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxImportBytes caps the body of a text import.
+const maxImportBytes int64 = 1 << 20
+
+// skippedLine is a line of a text import that didn't become a todo.
+type skippedLine struct {
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+}
+
+// importText creates one todo per non-empty line of a text/plain body, in
+// order and in one insert. A line starting with "x " is a completed todo,
+// as in todo.txt.
+func importText(w http.ResponseWriter, r *http.Request) {
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "text/plain" {
+		rndr.JSON(w, http.StatusUnsupportedMediaType, renderer.M{
+			"error": "The import must be sent as text/plain",
+		})
+		return
+	}
+
+	if r.ContentLength > maxImportBytes {
+		renderImportTooLarge(w)
+		return
+	}
+
+	now := time.Now().UTC()
+	docs := []interface{}{}
+	skipped := []skippedLine{}
+
+	// One byte past the cap is read to tell a body that fits from one that
+	// was cut off, whose last line would otherwise pass for a todo.
+	body := &io.LimitedReader{R: r.Body, N: maxImportBytes + 1}
+	sc := bufio.NewScanner(body)
+	sc.Buffer(make([]byte, 0, 64*1024), int(maxImportBytes)+1)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		completed := strings.HasPrefix(line, "x ")
+		if completed {
+			line = strings.TrimPrefix(line, "x ")
+		}
+
+		title, err := validateTitle(line)
+		if err != nil {
+			skipped = append(skipped, skippedLine{Line: n, Reason: err.Error()})
+			continue
+		}
+		// Counting stops at the first todo over the cap, the rest of the
+		// body isn't read.
+		if batchTooLarge(w, len(docs)+1) {
+			return
+		}
+
+		docs = append(docs, &todoModel{
+			ID:          bson.NewObjectId(),
+			Title:       title,
+			Completed:   completed,
+			Tags:        []string{},
+			CreatedAt:   now,
+			CompletedAt: completedAt(completed),
+			ExpireAt:    expireAt(completed),
+		})
+	}
+	if body.N == 0 {
+		renderImportTooLarge(w)
+		return
+	}
+	if err := sc.Err(); err != nil {
+		log.Printf("level=warn msg=\"unreadable import\" error=%q", err)
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "Failed to read the import",
+		})
+		return
+	}
+
+	if len(docs) > 0 {
+		position, err := nextPosition(r.Context())
+		if err != nil {
+			renderDBError(w, "Failed to import TODOs", err)
+			return
+		}
+		for i, doc := range docs {
+			doc.(*todoModel).Position = position + i
+		}
+
+		if err := timeQuery(r.Context(), "insert", nil, func() error {
+			return db.C(collectionName).Insert(docs...)
+		}); err != nil {
+			renderDBError(w, "Failed to import TODOs", err)
+			return
+		}
+	}
+
+	status := http.StatusCreated
+	if len(docs) == 0 {
+		status = http.StatusOK
+	}
+	respondOK(w, status, renderer.M{
+		"created": len(docs),
+		"skipped": skipped,
+	}, renderer.M{
+		"message": "TODOs imported successfully.",
+	})
+}
+
+func renderImportTooLarge(w http.ResponseWriter) {
+	rndr.JSON(w, http.StatusRequestEntityTooLarge, renderer.M{
+		"error": fmt.Sprintf("The import cannot be larger than %d bytes", maxImportBytes),
+	})
+}
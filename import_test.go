@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func importRequest(body string, knownLength bool) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/todo/import", strings.NewReader(body))
+	r.Header.Set("Content-Type", "text/plain")
+	if !knownLength {
+		// As with a chunked upload, only reading tells the size.
+		r.ContentLength = -1
+		r.Body = io.NopCloser(strings.NewReader(body))
+	}
+	return r
+}
+
+func TestImportTextSizeLimit(t *testing.T) {
+	// Blank lines make no todos, so nothing here needs Mongo: a body over
+	// the limit has to be refused before any insert.
+	atLimit := strings.Repeat("\n", int(maxImportBytes))
+	overLimit := "Buy milk\n" + strings.Repeat("\n", int(maxImportBytes)-len("Buy milk\n")) + "Cut off tit"
+
+	tests := []struct {
+		name        string
+		body        string
+		knownLength bool
+		status      int
+	}{
+		{"at the limit", atLimit, true, http.StatusOK},
+		{"at the limit, chunked", atLimit, false, http.StatusOK},
+		{"over the limit", overLimit, true, http.StatusRequestEntityTooLarge},
+		{"over the limit, chunked", overLimit, false, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			importText(w, importRequest(tt.body, tt.knownLength))
+			if w.Code != tt.status {
+				t.Errorf("status = %d %s, want %d", w.Code, w.Body, tt.status)
+			}
+		})
+	}
+}
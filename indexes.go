@@ -0,0 +1,103 @@
+package main
+
+import (
+	"gopkg.in/mgo.v2"
+	"log"
+	"net/http"
+	"sync/atomic"
+)
+
+const (
+	indexExisted string = "existed"
+	indexCreated string = "created"
+	indexFailed  string = "failed"
+)
+
+type (
+	indexSpec struct {
+		collection string
+		index      mgo.Index
+	}
+
+	indexReport struct {
+		Collection string `json:"collection"`
+		Name       string `json:"name"`
+		Status     string `json:"status"`
+		Error      string `json:"error,omitempty"`
+	}
+)
+
+// listOrder is the default order of todo lists, backed by the
+// todo_pinned_position index.
+var listOrder = []string{"-pinned", "position", "_id"}
+
+// expectedIndexes lists every index the service relies on. Names are fixed
+// so reports can tell which ones already exist.
+func expectedIndexes() []indexSpec {
+	specs := []indexSpec{
+		{collectionName, mgo.Index{Key: []string{"createdAt"}, Name: "todo_created_at"}},
+		// The default list order, pinned first then by position, which
+		// lists, pages, the export and the home page all sort by.
+		{collectionName, mgo.Index{Key: listOrder, Name: "todo_pinned_position"}},
+		{collectionName, mgo.Index{Key: []string{"$text:title", "$text:description"}, Name: "todo_text"}},
+		{collectionName, mgo.Index{Key: []string{"externalId"}, Name: "todo_external_id", Unique: true, Sparse: true}},
+		{commentsName, mgo.Index{Key: []string{"todoId", "createdAt"}, Name: "todoId_1_createdAt_1"}},
+	}
+	if cfg.completedTTL > 0 {
+		specs = append(specs, indexSpec{collectionName, expiryIndex})
+	}
+	return specs
+}
+
+// ensureIndexes creates any missing expected index. EnsureIndex is
+// idempotent, so running it again only reports what is already there.
+func ensureIndexes() []indexReport {
+	existing := map[string]map[string]bool{}
+	reports := []indexReport{}
+
+	for _, spec := range expectedIndexes() {
+		if existing[spec.collection] == nil {
+			existing[spec.collection] = map[string]bool{}
+			indexes, err := db.C(spec.collection).Indexes()
+			if err != nil {
+				log.Println("Failed to list indexes of", spec.collection, err)
+			}
+			for _, index := range indexes {
+				existing[spec.collection][index.Name] = true
+			}
+		}
+
+		report := indexReport{Collection: spec.collection, Name: spec.index.Name, Status: indexExisted}
+		if !existing[spec.collection][spec.index.Name] {
+			report.Status = indexCreated
+		}
+		if err := db.C(spec.collection).EnsureIndex(spec.index); err != nil {
+			// Mongo's message stays in the log, the admin report only says
+			// which index failed.
+			log.Printf("Failed to create index %s on %s: %s", spec.index.Name, spec.collection, err)
+			report.Status = indexFailed
+			report.Error = "The index could not be created, see the server log"
+		}
+		if spec.index.Name == "todo_text" {
+			setTextIndexReady(report.Status != indexFailed)
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+func ensureIndexesHandler(w http.ResponseWriter, r *http.Request) {
+	respondOK(w, http.StatusOK, ensureIndexes(), nil)
+}
+
+func textIndexReady() bool {
+	return atomic.LoadInt32(&textIndex) == 1
+}
+
+func setTextIndexReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&textIndex, v)
+}
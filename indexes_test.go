@@ -0,0 +1,68 @@
+package main
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// Reindexing flips the flag while searches read it; run with -race.
+func TestTextIndexReadyIsSafeForConcurrentUse(t *testing.T) {
+	defer setTextIndexReady(textIndexReady())
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				setTextIndexReady((i+j)%2 == 0)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				textIndexReady()
+			}
+		}()
+	}
+	wg.Wait()
+
+	setTextIndexReady(true)
+	if !textIndexReady() {
+		t.Error("textIndexReady() = false after setTextIndexReady(true)")
+	}
+	setTextIndexReady(false)
+	if textIndexReady() {
+		t.Error("textIndexReady() = true after setTextIndexReady(false)")
+	}
+}
+
+// The default list sort must match an index, or large collections fall
+// back to an in-memory sort and hit Mongo's limit.
+func TestDefaultListOrderIsIndexed(t *testing.T) {
+	var found bool
+	for _, spec := range expectedIndexes() {
+		if spec.collection == collectionName && reflect.DeepEqual(spec.index.Key, listOrder) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("no expected index has the key %v", listOrder)
+	}
+
+	var order []string
+	for _, e := range sortStage("position")["$sort"].(bson.D) {
+		if e.Value == -1 {
+			order = append(order, "-"+e.Name)
+		} else {
+			order = append(order, e.Name)
+		}
+	}
+	if !reflect.DeepEqual(order, listOrder) {
+		t.Errorf("the default page sort is %v, want %v", order, listOrder)
+	}
+	if !queryFields["position"].indexed {
+		t.Error("position isn't marked as indexed")
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+)
+
+// jobs tracks the background goroutines, so that shutdown can stop them and
+// wait for the work they're in the middle of instead of cutting it off.
+var jobs = newJobGroup()
+
+type jobGroup struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	running map[string]int
+}
+
+func newJobGroup() *jobGroup {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &jobGroup{ctx: ctx, cancel: cancel, running: map[string]int{}}
+}
+
+// start runs fn in its own goroutine. fn must return soon after ctx is done.
+func (g *jobGroup) start(name string, fn func(ctx context.Context)) {
+	g.mu.Lock()
+	g.running[name]++
+	g.mu.Unlock()
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer func() {
+			g.mu.Lock()
+			if g.running[name]--; g.running[name] == 0 {
+				delete(g.running, name)
+			}
+			g.mu.Unlock()
+		}()
+		fn(g.ctx)
+	}()
+}
+
+// stop cancels every job and waits until they've all returned or ctx is
+// done, logging the ones still running in the latter case.
+func (g *jobGroup) stop(ctx context.Context) {
+	g.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		g.mu.Lock()
+		names := []string{}
+		for name := range g.running {
+			names = append(names, name)
+		}
+		g.mu.Unlock()
+		sort.Strings(names)
+		log.Printf("level=warn msg=\"background jobs still running at shutdown\" jobs=%q", names)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// A leased todo is "in progress": a worker took it from POST /todo/next and
+// holds it until leaseExpiresAt. Expired leases are simply ignored, so the
+// todo of a crashed worker goes back to the queue on its own.
+
+// maxLeaseAttempts bounds how often POST /todo/next retries when other
+// workers keep taking the todos it's about to lease.
+const maxLeaseAttempts = 3
+
+var errLeaseContention = errors.New("Other workers took every candidate TODO, please retry")
+
+type leaseRequest struct {
+	Owner string `json:"owner"`
+}
+
+// leasable selects the open todos nobody holds a live lease on.
+func leasable(now time.Time) bson.M {
+	filter := notDeleted()
+	filter["completed"] = false
+	filter["archived"] = bson.M{"$ne": true}
+	filter["$or"] = []bson.M{
+		{"leaseExpiresAt": bson.M{"$exists": false}},
+		{"leaseExpiresAt": bson.M{"$lte": now}},
+	}
+	return filter
+}
+
+// leased selects the todos currently in progress.
+func leased(now time.Time) bson.M {
+	return bson.M{"leaseExpiresAt": bson.M{"$gt": now}}
+}
+
+// leaseNext leases the most important, soonest due leasable todo to owner
+// with findAndModify, so two workers never get the same one. Mongo sorts
+// todos without a due date first, so dated ones are tried before undated
+// ones of the same priority.
+func leaseNext(ctx context.Context, owner string) (todoModel, error) {
+	c := db.C(collectionName)
+	for attempt := 0; attempt < maxLeaseAttempts; attempt++ {
+		now := time.Now().UTC()
+
+		var top todoModel
+		filter := leasable(now)
+		if err := timeQuery(ctx, "findOne", filter, func() error {
+			return c.Find(filter).Select(bson.M{"priority": 1}).Sort("-priority").One(&top)
+		}); err != nil {
+			return todoModel{}, err
+		}
+
+		change := mgo.Change{
+			Update: bson.M{"$set": bson.M{
+				"leaseOwner":     owner,
+				"leasedAt":       now,
+				"leaseExpiresAt": now.Add(cfg.leaseDuration),
+			}},
+			ReturnNew: true,
+		}
+		for _, dated := range []bool{true, false} {
+			selector := leasable(now)
+			selector["priority"] = top.Priority
+			selector["dueDate"] = bson.M{"$exists": dated}
+
+			var tm todoModel
+			err := timeQuery(ctx, "findAndModify", selector, func() (err error) {
+				_, err = c.Find(selector).Sort("dueDate", "position", "_id").Apply(change, &tm)
+				return err
+			})
+			if err == nil {
+				return tm, nil
+			}
+			if err != mgo.ErrNotFound {
+				return todoModel{}, err
+			}
+		}
+	}
+	return todoModel{}, errLeaseContention
+}
+
+func fetchNextTodo(w http.ResponseWriter, r *http.Request) {
+	loc, ok := parseTimezone(w, r)
+	if !ok {
+		return
+	}
+
+	var req leaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		renderBadBody(w, err)
+		return
+	}
+	req.Owner = strings.TrimSpace(req.Owner)
+	if req.Owner == "" {
+		rndr.JSON(w, http.StatusUnprocessableEntity, renderer.M{
+			"errors": []fieldError{{Field: "owner", Pointer: "/owner", Message: "The owner cannot be empty"}},
+		})
+		return
+	}
+
+	tm, err := leaseNext(r.Context(), req.Owner)
+	switch err {
+	case nil:
+	case mgo.ErrNotFound:
+		rndr.JSON(w, http.StatusNotFound, renderer.M{
+			"message": "Nothing to do, every TODO is done or in progress!",
+		})
+		return
+	case errLeaseContention:
+		w.Header().Set("Retry-After", "1")
+		rndr.JSON(w, http.StatusConflict, renderer.M{
+			"error": err.Error(),
+		})
+		return
+	default:
+		renderDBError(w, "Failed to lease the next TODO", err)
+		return
+	}
+
+	respondOK(w, http.StatusOK, toTodo(tm, loc), nil)
+}
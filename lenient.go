@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// lenientBoolFields are the todo payload fields LENIENT_DECODE coerces to a
+// boolean.
+var lenientBoolFields = []string{"completed"}
+
+// coerceLenient rewrites, in a decoded todo payload, the 0/1 numbers and
+// "true"/"false" strings older clients send for boolean fields into real
+// booleans. It runs before the schema check, so the rest of the pipeline
+// only ever sees booleans; anything else is left for the schema to reject.
+// It reports whether doc changed.
+func coerceLenient(doc interface{}) bool {
+	obj, ok := doc.(map[string]interface{})
+	if !ok || !cfg.lenientDecode {
+		return false
+	}
+
+	changed := false
+	for _, field := range lenientBoolFields {
+		var b, ok bool
+		switch v := obj[field].(type) {
+		case json.Number:
+			switch v.String() {
+			case "0":
+				b, ok = false, true
+			case "1":
+				b, ok = true, true
+			}
+		case string:
+			switch strings.ToLower(strings.TrimSpace(v)) {
+			case "false":
+				b, ok = false, true
+			case "true":
+				b, ok = true, true
+			}
+		}
+		if ok {
+			obj[field] = b
+			changed = true
+		}
+	}
+	return changed
+}
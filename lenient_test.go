@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func decodeDoc(t *testing.T, raw string) interface{} {
+	t.Helper()
+	d := json.NewDecoder(strings.NewReader(raw))
+	d.UseNumber()
+	var doc interface{}
+	if err := d.Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestCoerceLenient(t *testing.T) {
+	prev := cfg.lenientDecode
+	t.Cleanup(func() { cfg.lenientDecode = prev })
+
+	tests := []struct {
+		in      string
+		want    interface{}
+		changed bool
+	}{
+		{`{"completed":true}`, true, false},
+		{`{"completed":false}`, false, false},
+		{`{"completed":1}`, true, true},
+		{`{"completed":0}`, false, true},
+		{`{"completed":"true"}`, true, true},
+		{`{"completed":" FALSE "}`, false, true},
+		{`{"completed":2}`, json.Number("2"), false},
+		{`{"completed":1.0}`, json.Number("1.0"), false},
+		{`{"completed":"yes"}`, "yes", false},
+		{`{"completed":null}`, nil, false},
+	}
+	for _, tt := range tests {
+		cfg.lenientDecode = true
+		doc := decodeDoc(t, tt.in)
+		changed := coerceLenient(doc)
+		got := doc.(map[string]interface{})["completed"]
+		if changed != tt.changed || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("coerceLenient(%s) = %v, completed %#v, want %v, %#v", tt.in, changed, got, tt.changed, tt.want)
+		}
+
+		cfg.lenientDecode = false
+		doc = decodeDoc(t, tt.in)
+		if coerceLenient(doc) {
+			t.Errorf("coerceLenient(%s) changed the payload with LENIENT_DECODE off", tt.in)
+		}
+	}
+
+	cfg.lenientDecode = true
+	for _, raw := range []string{`[{"completed":1}]`, `"1"`, `{"title":"1"}`} {
+		doc := decodeDoc(t, raw)
+		if coerceLenient(doc) {
+			t.Errorf("coerceLenient(%s) changed something that isn't a boolean field", raw)
+		}
+	}
+}
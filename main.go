@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/thedevsaddam/renderer"
@@ -12,6 +13,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -19,57 +22,178 @@ import (
 var rndr *renderer.Render
 var db *mgo.Database
 
+// textIndex is 1 while the text index exists, so ?search= can fall back to
+// a regex scan when it doesn't. /admin/reindex sets it while searches read
+// it, hence the atomic access.
+var textIndex int32
+
 const (
 	hostName       string = "localhost:5500"
 	dbName         string = "demo_todo"
 	collectionName string = "todo"
+	commentsName   string = "comments"
+	snapshotsName  string = "snapshots"
+	pinsName       string = "pins"
 	port           string = ":9000"
+
+	maxTitleLength          int = 200
+	maxDescriptionLength    int = 2000
+	maxAssigneeLength       int = 64
+	maxExternalIDLength     int = 128
+	maxTagLength            int = 32
+	maxCommentLength        int = 1000
+	maxAuthorLength         int = 64
+	maxAttachmentNameLength int = 255
+	maxSortKeyLength        int = 128
+	maxMetadataKeyLength    int = 64
+	maxMetadataValueLength  int = 512
 )
 
 type (
 	todoModel struct {
-		ID        bson.ObjectId `bson:"_id,omitempty"`
-		Title     string        `bson:"title"`
-		Completed bool          `bson:"completed"`
-		CreatedAt time.Time     `bson:"createdAt"`
+		ID              bson.ObjectId     `bson:"_id,omitempty"`
+		Title           string            `bson:"title"`
+		ExternalID      string            `bson:"externalId,omitempty"`
+		Description     string            `bson:"description"`
+		Completed       bool              `bson:"completed"`
+		Archived        bool              `bson:"archived"`
+		Pinned          bool              `bson:"pinned"`
+		Assignee        string            `bson:"assignee"`
+		Tags            []string          `bson:"tags"`
+		EstimateMinutes int               `bson:"estimateMinutes"`
+		Priority        int               `bson:"priority"`
+		DueDate         *time.Time        `bson:"dueDate,omitempty"`
+		Position        int               `bson:"position"`
+		SortKey         string            `bson:"sortKey,omitempty"`
+		Metadata        map[string]string `bson:"metadata,omitempty"`
+		CommentCount    int               `bson:"commentCount"`
+		Attachments     []attachmentModel `bson:"attachments,omitempty"`
+		CreatedAt       time.Time         `bson:"createdAt"`
+		CompletedAt     *time.Time        `bson:"completedAt,omitempty"`
+		LeaseOwner      string            `bson:"leaseOwner,omitempty"`
+		LeasedAt        *time.Time        `bson:"leasedAt,omitempty"`
+		LeaseExpiresAt  *time.Time        `bson:"leaseExpiresAt,omitempty"`
+		ExpireAt        *time.Time        `bson:"expireAt,omitempty"`
+		DeletedAt       *time.Time        `bson:"deletedAt,omitempty"`
+		Score           float64           `bson:"score,omitempty"`
 	}
 
 	todo struct {
-		ID        string    `json:"id"`
-		Title     string    `json:"title"`
-		Completed bool      `json:"completed"`
-		CreatedAt time.Time `json:"createdAt"`
+		ID              string            `json:"id"`
+		Title           string            `json:"title"`
+		ExternalID      string            `json:"externalId,omitempty"`
+		Description     string            `json:"description"`
+		DescriptionHTML string            `json:"descriptionHtml,omitempty"`
+		Completed       bool              `json:"completed"`
+		Archived        bool              `json:"archived"`
+		Pinned          bool              `json:"pinned"`
+		Assignee        string            `json:"assignee"`
+		Tags            []string          `json:"tags"`
+		EstimateMinutes int               `json:"estimateMinutes"`
+		Priority        string            `json:"priority"`
+		DueDate         *time.Time        `json:"dueDate,omitempty"`
+		Position        int               `json:"position"`
+		SortKey         string            `json:"sortKey,omitempty"`
+		Metadata        map[string]string `json:"metadata,omitempty"`
+		CommentCount    int               `json:"commentCount"`
+		Attachments     []attachment      `json:"attachments"`
+		CreatedAt       time.Time         `json:"createdAt"`
+		CompletedAt     *time.Time        `json:"completedAt,omitempty"`
+		LeaseOwner      string            `json:"leaseOwner,omitempty"`
+		LeasedAt        *time.Time        `json:"leasedAt,omitempty"`
+		LeaseExpiresAt  *time.Time        `json:"leaseExpiresAt,omitempty"`
+		DeletedAt       *time.Time        `json:"deletedAt,omitempty"`
+		Score           float64           `json:"score,omitempty"`
+	}
+
+	moveRequest struct {
+		Position *int   `json:"position"`
+		After    string `json:"after"`
+	}
+
+	todoPosition struct {
+		ID       string `json:"id"`
+		Position int    `json:"position"`
 	}
 )
 
 func init() {
+	cfg = loadConfig()
 	rndr = renderer.New()
+	compileSchemas()
+	checkHomeTemplate()
+	setMaintenance(cfg.maintenance)
+	checkCORS(cfg)
+	if cfg.readCacheSize > 0 {
+		reads = newReadCache(cfg.readCacheSize)
+	}
+	if cfg.eventLogSize > 0 {
+		events = newEventLog(cfg.eventLogSize)
+	}
+}
+
+// connectDB dials Mongo and makes sure the indexes exist. It's left out of
+// init so that the tests of the pure helpers run without a database.
+func connectDB() {
 	session, err := mgo.Dial(hostName)
 	checkerr(err)
 	session.SetMode(mgo.Monotonic, true)
+	if cfg.requestTimeout > 0 {
+		session.SetSocketTimeout(cfg.requestTimeout)
+	}
 	db = session.DB(dbName)
+
+	ensureIndexes()
+	if err := syncPins(); err != nil {
+		log.Println("Failed to rebuild the pin list:", err)
+	}
 }
 
 func main() {
-	stopChan := make(chan os.Signal)
+	connectDB()
+
+	stopChan := make(chan os.Signal, 1)
 	signal.Notify(stopChan, os.Interrupt)
 
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
+	r.Use(writeOnce)
+	r.Use(responseTiming)
+	r.Use(corsHandler)
+	r.Use(fieldNaming)
 	r.Get("/", homeHandler)
+	r.Post("/", createTodoForm)
+	r.Head("/", homeHead)
+	r.Options("/", homeOptions)
+	r.Get("/ping", pingDB)
 	r.Mount("/todo", todoHandler())
+	// The export streams for as long as it takes, so it's routed around the
+	// todo router's REQUEST_TIMEOUT, which would cut it off.
+	r.Get("/todo/export", exportTodos)
+	r.Mount("/admin", adminHandler())
+
+	// chi keeps the full path in r.URL when mounting, so the Link headers
+	// built from it already carry the base path.
+	var handler http.Handler = r
+	if cfg.basePath != "" {
+		root := chi.NewRouter()
+		root.Mount(cfg.basePath, r)
+		handler = root
+	}
 
 	srv := &http.Server{
 		Addr:         ":9000",
-		Handler:      r,
+		Handler:      handler,
 		ReadTimeout:  60 * time.Second,
 		WriteTimeout: 60 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
 
+	jobs.start("snapshot", snapshotJob)
+
 	go func() {
 		log.Println("Listening on the port", port)
-		if err := srv.ListenAndServe(); err != nil {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Listen: %s\n", err)
 		}
 	}()
@@ -81,6 +205,9 @@ func main() {
 		checkerr(err)
 	}
 	defer cancel()
+	// The jobs may still need the database, so it's closed after them.
+	jobs.stop(ctx)
+	db.Session.Close()
 	log.Println("Server successfully shutdown.")
 }
 
@@ -91,18 +218,75 @@ func checkerr(err error) {
 }
 
 func homeHandler(w http.ResponseWriter, r *http.Request) {
-	err := rndr.Template(w, http.StatusOK, []string{"static/home.tpl"}, nil)
-	checkerr(err)
+	// The page calls the API with relative URLs, which only resolve under
+	// the base path with a trailing slash.
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+		return
+	}
 
+	if cfg.homePage == homePageServer {
+		renderHomePage(w, r, http.StatusOK, "")
+		return
+	}
+
+	renderTemplate(w, http.StatusOK, appTemplate, nil)
 }
 
 func todoHandler() http.Handler {
 	rg := chi.NewRouter()
+	rg.Use(requestTimeout)
+	rg.Use(recordEvents)
+	rg.Use(maintenanceGuard)
+	// The text import has its own media type, so it stays out of the JSON
+	// group.
+	rg.Post("/import/text", importText)
 	rg.Group(func(r chi.Router) {
+		r.Use(strictJSON)
 		r.Post("/", createTodo)
-		r.Get("/", fetchTodo)
+		r.Post("/bulk", bulkCreateTodo)
+		r.Post("/bulk-update", bulkUpdateTodo)
+		r.Get("/schema", fetchTodoSchema)
+		r.Post("/validate", validateTodoPayload)
+		r.Post("/search", searchTodos)
+		r.With(cacheReads).Get("/", fetchTodo)
+		r.Delete("/", trashTodos)
+		r.Get("/unassigned", fetchUnassignedTodo)
+		r.Get("/assignees", fetchAssignees)
+		r.Get("/random", fetchRandomTodo)
+		r.Get("/stats", fetchTodoStats)
+		r.Get("/stats/timeline", fetchTodoTimeline)
+		r.Get("/stats/trend", fetchTodoTrend)
+		r.Get("/today", fetchTodayTodo)
+		r.Get("/recently-completed", fetchRecentlyCompletedTodo)
+		r.Get("/sort-key", fetchSortKey)
+		r.Get("/trash", fetchTrash)
+		r.Delete("/trash", purgeTrash)
+		r.Post("/tags", bulkTagTodo)
+		r.Post("/next", fetchNextTodo)
+		r.Post("/complete", completeTodo)
+		r.Post("/schedule", scheduleTodo)
+		r.Post("/complete-all", completeAllTodo)
+		r.Delete("/completed", clearCompletedTodo)
+		r.With(cacheReads).Get("/{id}", fetchSingleTodo)
 		r.Put("/{id}", updateTodo)
+		r.Patch("/{id}", patchTodo)
 		r.Delete("/{id}", deleteTodo)
+		r.Post("/{id}/move", moveTodo)
+		r.Post("/{id}/move-up", moveUpTodo)
+		r.Post("/{id}/move-down", moveDownTodo)
+		r.Post("/{id}/restore", restoreTodo)
+		r.Post("/{id}/toggle", toggleTodo)
+		r.Post("/{id}/pin", pinTodo)
+		r.Post("/{id}/unpin", unpinTodo)
+		r.Post("/{id}/archive", archiveTodo)
+		r.Post("/{id}/unarchive", unarchiveTodo)
+		r.Post("/{id}/comments", createComment)
+		r.Get("/{id}/comments", fetchComments)
+		r.Get("/{id}/export", exportSingleTodo)
+		r.Delete("/{id}/comments/{commentId}", deleteComment)
+		r.Post("/{id}/attachments", createAttachment)
+		r.Delete("/{id}/attachments/{attachmentId}", deleteAttachment)
 	})
 	return rg
 }
@@ -110,72 +294,537 @@ func todoHandler() http.Handler {
 func createTodo(w http.ResponseWriter, r *http.Request) {
 	var t todo
 
-	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
-		if err1 := rndr.JSON(w, http.StatusProcessing, err); err1 != nil {
-			checkerr(err1)
-		}
+	if !decodeTodo(w, r, &t) {
 		return
 	}
 
-	if t.Title == "" {
-		rndr.JSON(w, http.StatusProcessing, renderer.M{
-			"error": "The title cannot be empty",
+	if errs := validateTodo(&t); len(errs) > 0 {
+		rndr.JSON(w, http.StatusUnprocessableEntity, renderer.M{
+			"errors": errs,
 		})
 		return
 	}
 
+	// A todo synced from another system is created only once: posting the
+	// same externalId again returns the todo that already exists.
+	if t.ExternalID != "" && renderExistingExternal(w, r, t.ExternalID) {
+		return
+	}
+
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now()
+	}
+	errs, warnings := checkDueDate(&t, strictDates(r))
+	if len(errs) > 0 {
+		rndr.JSON(w, http.StatusUnprocessableEntity, renderer.M{
+			"errors": errs,
+		})
+		return
+	}
+
+	position, err := nextPosition(r.Context())
+	if err != nil {
+		renderDBError(w, "Failed to create TODO", err)
+		return
+	}
+
+	// Offline clients may pick the id themselves; the schema has checked
+	// it's an ObjectId.
+	id := bson.NewObjectId()
+	if t.ID != "" {
+		id = bson.ObjectIdHex(t.ID)
+	}
+
 	tm := todoModel{
-		ID:        bson.NewObjectId(),
-		Title:     t.Title,
-		Completed: t.Completed,
-		CreatedAt: t.CreatedAt,
+		ID:              id,
+		Title:           t.Title,
+		ExternalID:      t.ExternalID,
+		Description:     t.Description,
+		Completed:       t.Completed,
+		Assignee:        t.Assignee,
+		Tags:            t.Tags,
+		EstimateMinutes: t.EstimateMinutes,
+		Priority:        priorityRanks[t.Priority],
+		DueDate:         utcTime(t.DueDate),
+		Position:        position,
+		SortKey:         t.SortKey,
+		Metadata:        t.Metadata,
+		CreatedAt:       t.CreatedAt.UTC(),
+		CompletedAt:     completedAt(t.Completed),
+		ExpireAt:        expireAt(t.Completed),
 	}
 
-	if err := db.C(collectionName).Insert(&tm); err != nil {
-		if err1 := rndr.JSON(w, http.StatusProcessing, renderer.M{
-			"message": "Failed to create TODO",
-			"error":   err,
-		}); err1 != nil {
-			checkerr(err1)
+	// The duplicate check is only a hint, so it must run before the insert
+	// and a failure to count doesn't stop the create.
+	duplicate := false
+	if r.URL.Query().Get("checkDuplicate") == "true" {
+		filter := bson.M{"title": tm.Title}
+		var n int
+		if err := timeQuery(r.Context(), "count", filter, func() (err error) {
+			n, err = db.C(collectionName).Find(filter).Count()
+			return err
+		}); err != nil {
+			log.Println("Duplicate title check failed:", err)
 		}
+		duplicate = n > 0
+	}
+
+	if err := timeQuery(r.Context(), "insert", nil, func() error {
+		return db.C(collectionName).Insert(&tm)
+	}); err != nil {
+		// Lost a race with a concurrent create of the same externalId.
+		if mgo.IsDup(err) && tm.ExternalID != "" && renderExistingExternal(w, r, tm.ExternalID) {
+			return
+		}
+		// The insert never overwrites, so a taken client id is a conflict.
+		if mgo.IsDup(err) && t.ID != "" {
+			taken := bson.M{"_id": tm.ID}
+			var n int
+			cerr := timeQuery(r.Context(), "count", taken, func() (err error) {
+				n, err = db.C(collectionName).Find(taken).Count()
+				return err
+			})
+			if cerr == nil && n > 0 {
+				rndr.JSON(w, http.StatusConflict, renderer.M{
+					"error": "A TODO with this id already exists",
+					"id":    tm.ID.Hex(),
+				})
+				return
+			}
+		}
+		renderDBError(w, "Failed to create TODO", err)
 		return
 	}
 
-	rndr.JSON(w, http.StatusCreated, renderer.M{
+	self := todoURL(tm.ID)
+	w.Header().Set("Location", self)
+	meta := renderer.M{
 		"message": "TODO created successfully",
-		"todo_id": tm.ID.Hex(),
+		"links":   renderer.M{"self": self},
+	}
+	if duplicate {
+		meta["warning"] = "a todo with this title already exists"
+	}
+	if len(warnings) > 0 {
+		meta["warnings"] = warnings
+	}
+	respondOK(w, http.StatusCreated, toTodo(tm, time.UTC), meta)
+}
+
+// todoURL is the canonical path of a todo, under BASE_PATH when the service
+// runs behind a proxy.
+func todoURL(id bson.ObjectId) string {
+	return cfg.basePath + "/todo/" + id.Hex()
+}
+
+// validateTodoPayload runs a create payload through the same checks as
+// POST /todo without saving it, for validating a form as it's filled in.
+func validateTodoPayload(w http.ResponseWriter, r *http.Request) {
+	var t todo
+
+	if !decodeTodo(w, r, &t) {
+		return
+	}
+	errs := validateTodo(&t)
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now()
+	}
+	dueErrs, warnings := checkDueDate(&t, strictDates(r))
+	if errs = append(errs, dueErrs...); len(errs) > 0 {
+		rndr.JSON(w, http.StatusUnprocessableEntity, renderer.M{
+			"errors": errs,
+		})
+		return
+	}
+
+	var meta renderer.M
+	if len(warnings) > 0 {
+		meta = renderer.M{"warnings": warnings}
+	}
+	respondOK(w, http.StatusOK, renderer.M{
+		"valid": true,
+	}, meta)
+}
+
+// renderExistingExternal answers a create with the todo already carrying
+// externalID, reporting whether there was one.
+func renderExistingExternal(w http.ResponseWriter, r *http.Request, externalID string) bool {
+	var existing todoModel
+	filter := bson.M{"externalId": externalID}
+	if err := timeQuery(r.Context(), "find", filter, func() error {
+		return db.C(collectionName).Find(filter).One(&existing)
+	}); err != nil {
+		if err != mgo.ErrNotFound {
+			log.Println("External id lookup failed:", err)
+		}
+		return false
+	}
+
+	respondOK(w, http.StatusOK, toTodo(existing, time.UTC), renderer.M{
+		"message": "TODO already exists",
 	})
+	return true
 }
 
 func fetchTodo(w http.ResponseWriter, r *http.Request) {
-	todos := []todoModel{}
+	loc, ok := parseTimezone(w, r)
+	if !ok {
+		return
+	}
+
+	if r.URL.Query().Get("ids") != "" {
+		fetchTodosByID(w, r, loc)
+		return
+	}
+
+	filter, err := todoFilter(r)
+	if err == nil {
+		err = completedFilter(r, filter)
+	}
+	if err != nil {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": err.Error(),
+		})
+		return
+	}
+	query := r.URL.Query()
+
+	if q := strings.TrimSpace(query.Get("q")); q != "" {
+		if query.Get("fuzzy") == "true" {
+			fuzzySearchTodos(w, r, filter, q, loc)
+			return
+		}
+		regexSearchTodos(w, r, filter, q, loc)
+		return
+	}
+
+	if search := strings.TrimSpace(query.Get("search")); search != "" {
+		if textIndexReady() {
+			textSearchTodos(w, r, filter, search, loc)
+			return
+		}
+		filter["title"] = bson.M{"$regex": regexp.QuoteMeta(search), "$options": "i"}
+	}
+
+	listTodos(w, r, filter, loc)
+}
+
+// todoFilter builds the Mongo filter for the plain field query params shared
+// by the list-style endpoints. Deleted todos are always left out, archived
+// ones unless ?state= asks for them.
+func todoFilter(r *http.Request) (bson.M, error) {
+	filter := notDeleted()
+	query := r.URL.Query()
+	if err := checkFilterParams(query); err != nil {
+		return nil, err
+	}
+
+	switch state := query.Get("state"); state {
+	case "":
+		filter["archived"] = bson.M{"$ne": true}
+	case "active":
+		filter["archived"] = bson.M{"$ne": true}
+		filter["completed"] = false
+	case "completed":
+		filter["archived"] = bson.M{"$ne": true}
+		filter["completed"] = true
+	case "in-progress":
+		filter["archived"] = bson.M{"$ne": true}
+		filter["completed"] = false
+		for k, v := range leased(time.Now().UTC()) {
+			filter[k] = v
+		}
+	case "archived":
+		filter["archived"] = true
+	case "all":
+	default:
+		return nil, errors.New("Invalid state " + state + ", expected active, completed, in-progress, archived or all")
+	}
+
+	if assignee := strings.TrimSpace(query.Get("assignee")); assignee != "" {
+		filter[queryFields["assignee"].bson] = assignee
+	}
 
-	if err := db.C(collectionName).Find(bson.M{}).All(&todos); err != nil {
-		if err1 := rndr.JSON(w, http.StatusProcessing, renderer.M{
-			"message": "Failed to fetch todo",
-			"error":   err,
+	if tag := normalizeTag(query.Get("tag")); tag != "" {
+		filter[queryFields["tag"].bson] = tag
+	}
+
+	if priority := query.Get("priority"); priority != "" {
+		rank, ok := priorityRanks[priority]
+		if !ok {
+			return nil, errors.New("Invalid priority " + priority + ", expected low, medium or high")
+		}
+		filter[queryFields["priority"].bson] = rank
+	}
+
+	for name, values := range query {
+		if !strings.HasPrefix(name, "meta.") {
+			continue
+		}
+		key := strings.TrimPrefix(name, "meta.")
+		if !metadataKeyPattern.MatchString(key) {
+			return nil, errors.New("Invalid metadata key " + key)
+		}
+		filter["metadata."+key] = values[0]
+	}
+
+	return filter, nil
+}
+
+// completedFilter applies the completion params of GET /todo, in order of
+// precedence: an explicit ?state= decides alone, then ?completed=true|false
+// keeps only done or open todos, then ?includeCompleted=true keeps both.
+// Without any of them completed todos are listed unless
+// DEFAULT_HIDE_COMPLETED is on.
+func completedFilter(r *http.Request, filter bson.M) error {
+	query := r.URL.Query()
+	if query.Get("state") != "" {
+		return nil
+	}
+
+	if v := query.Get("completed"); v != "" {
+		completed, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.New("Invalid completed " + v + ", expected true or false")
+		}
+		filter["completed"] = completed
+		return nil
+	}
+
+	include := !cfg.defaultHideCompleted
+	if v := query.Get("includeCompleted"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.New("Invalid includeCompleted " + v + ", expected true or false")
+		}
+		include = b
+	}
+	if !include {
+		filter["completed"] = false
+	}
+	return nil
+}
+
+func fetchUnassignedTodo(w http.ResponseWriter, r *http.Request) {
+	loc, ok := parseTimezone(w, r)
+	if !ok {
+		return
+	}
+
+	filter, err := todoFilter(r)
+	if err != nil {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": err.Error(),
+		})
+		return
+	}
+	filter["assignee"] = bson.M{"$in": []interface{}{"", nil}}
+
+	listTodos(w, r, filter, loc)
+}
+
+func fetchRandomTodo(w http.ResponseWriter, r *http.Request) {
+	loc, ok := parseTimezone(w, r)
+	if !ok {
+		return
+	}
+
+	filter, err := todoFilter(r)
+	if err != nil {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": err.Error(),
+		})
+		return
+	}
+	filter["completed"] = false
+
+	var tm todoModel
+	pipeline := []bson.M{
+		{"$match": filter},
+		{"$sample": bson.M{"size": 1}},
+	}
+	if err := timeQuery(r.Context(), "aggregate", pipeline, func() error {
+		return db.C(collectionName).Pipe(pipeline).One(&tm)
+	}); err != nil {
+		if err == mgo.ErrNotFound {
+			rndr.JSON(w, http.StatusNotFound, renderer.M{
+				"message": "Nothing to do, every matching TODO is done!",
+			})
+			return
+		}
+		renderDBError(w, "Failed to fetch todo", err)
+		return
+	}
+
+	respondOK(w, http.StatusOK, toTodo(tm, loc), nil)
+}
+
+// fetchSingleTodo renders one todo; with ?render=html its Markdown
+// description is also rendered to sanitized HTML as descriptionHtml.
+func fetchSingleTodo(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+
+	if !bson.IsObjectIdHex(id) {
+		if err1 := rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "Invalid URL request",
 		}); err1 != nil {
-			checkerr(err1)
+			renderFailed(err1)
+			return
 		}
 		return
 	}
 
-	todoList := []todo{}
+	loc, ok := parseTimezone(w, r)
+	if !ok {
+		return
+	}
 
-	for _, t := range todos {
-		todoList = append(todoList, todo{
-			ID:        t.ID.Hex(),
-			Title:     t.Title,
-			Completed: t.Completed,
-			CreatedAt: t.CreatedAt,
+	var tm todoModel
+	if err := timeQuery(r.Context(), "findId", nil, func() error {
+		return db.C(collectionName).Find(activeTodo(bson.ObjectIdHex(id))).One(&tm)
+	}); err != nil {
+		if err == mgo.ErrNotFound {
+			rndr.JSON(w, http.StatusNotFound, renderer.M{
+				"error": "TODO not found",
+			})
+			return
+		}
+		renderDBError(w, "Failed to fetch todo", err)
+		return
+	}
+
+	t := toTodo(tm, loc)
+	if r.URL.Query().Get("render") == "html" {
+		html, err := renderMarkdown(t.Description)
+		if err != nil {
+			log.Printf("level=error msg=\"Failed to render the description\" id=%s error=%q", t.ID, err)
+			if err1 := rndr.JSON(w, http.StatusInternalServerError, renderer.M{
+				"error": "Failed to render the description",
+			}); err1 != nil {
+				renderFailed(err1)
+			}
+			return
+		}
+		t.DescriptionHTML = html
+	}
+
+	respondOK(w, http.StatusOK, t, nil)
+}
+
+// listTodos streams the page of todos matching the filter selected by
+// ?limit= and ?offset= as the {"data": [...], "meta": {...}} list response.
+// Without ?limit= the page size is the default of the ?view=, and meta.limit
+// reports the one used.
+func listTodos(w http.ResponseWriter, r *http.Request, filter bson.M, loc *time.Location) {
+	view, err := parseView(r)
+	if err != nil {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": err.Error(),
 		})
+		return
 	}
-	if err1 := rndr.JSON(w, http.StatusOK, renderer.M{
-		"data": todoList,
-	}); err1 != nil {
-		checkerr(err1)
+
+	limit, offset, err := parsePagination(r, cfg.viewPageSizes[view])
+	if err != nil {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": err.Error(),
+		})
 		return
 	}
+
+	sortBy, err := parseSort(r)
+	if err != nil {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	convert := func(t todoModel) interface{} {
+		return toTodo(t, loc)
+	}
+	if view == viewSummary {
+		convert = func(t todoModel) interface{} {
+			return toTodoSummary(t)
+		}
+	}
+
+	// The page and its total come from one $facet round-trip.
+	renderFacetPage(w, r, filter, sortBy, view, limit, offset, convert)
+}
+
+// renderTodoList writes the list response; meta is left out when nil.
+func renderTodoList(w http.ResponseWriter, todos []todoModel, loc *time.Location, meta renderer.M) {
+	todoList := []todo{}
+
+	for _, t := range todos {
+		todoList = append(todoList, toTodo(t, loc))
+	}
+	respondOK(w, http.StatusOK, todoList, meta)
+}
+
+// toTodo converts a stored todo to its response form, with timestamps
+// rendered in loc.
+func toTodo(t todoModel, loc *time.Location) todo {
+	return todo{
+		ID:              t.ID.Hex(),
+		Title:           t.Title,
+		ExternalID:      t.ExternalID,
+		Description:     t.Description,
+		Completed:       t.Completed,
+		Archived:        t.Archived,
+		Pinned:          t.Pinned,
+		Assignee:        t.Assignee,
+		Tags:            tagsOrEmpty(t.Tags),
+		EstimateMinutes: t.EstimateMinutes,
+		Priority:        priorityNames[t.Priority],
+		DueDate:         timeIn(t.DueDate, loc),
+		Position:        t.Position,
+		SortKey:         t.SortKey,
+		Metadata:        t.Metadata,
+		CommentCount:    t.CommentCount,
+		Attachments:     toAttachments(t.Attachments),
+		CreatedAt:       t.CreatedAt.In(loc),
+		CompletedAt:     timeIn(t.CompletedAt, loc),
+		LeaseOwner:      t.LeaseOwner,
+		LeasedAt:        timeIn(t.LeasedAt, loc),
+		LeaseExpiresAt:  timeIn(t.LeaseExpiresAt, loc),
+		DeletedAt:       timeIn(t.DeletedAt, loc),
+		Score:           t.Score,
+	}
+}
+
+// utcTime converts an optional timestamp to UTC for storage.
+func utcTime(t *time.Time) *time.Time {
+	return timeIn(t, time.UTC)
+}
+
+// timeIn converts an optional timestamp to loc.
+func timeIn(t *time.Time, loc *time.Location) *time.Time {
+	if t == nil {
+		return nil
+	}
+	in := t.In(loc)
+	return &in
+}
+
+// parseTimezone resolves the ?tz= query param to a location, defaulting to
+// UTC. Unknown zones get a 400 and ok is false.
+func parseTimezone(w http.ResponseWriter, r *http.Request) (loc *time.Location, ok bool) {
+	name := strings.TrimSpace(r.URL.Query().Get("tz"))
+	if name == "" {
+		return time.UTC, true
+	}
+
+	// "Local" would leak the server's own zone, so only IANA names are accepted.
+	loc, err := time.LoadLocation(name)
+	if err != nil || name == "Local" {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "Unknown timezone " + name,
+		})
+		return nil, false
+	}
+	return loc, true
 }
 
 func updateTodo(w http.ResponseWriter, r *http.Request) {
@@ -185,7 +834,7 @@ func updateTodo(w http.ResponseWriter, r *http.Request) {
 		if err1 := rndr.JSON(w, http.StatusBadRequest, renderer.M{
 			"error": "Invalid URL request",
 		}); err1 != nil {
-			checkerr(err1)
+			renderFailed(err1)
 			return
 		}
 		return
@@ -193,68 +842,327 @@ func updateTodo(w http.ResponseWriter, r *http.Request) {
 
 	var t todo
 
-	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
-		if err1 := rndr.JSON(w, http.StatusProcessing, err); err1 != nil {
-			checkerr(err1)
-		}
+	if !decodeTodo(w, r, &t) {
 		return
 	}
 
-	if t.Title == "" {
-		rndr.JSON(w, http.StatusProcessing, renderer.M{
-			"error": "The title cannot be empty",
+	if errs := validateTodo(&t); len(errs) > 0 {
+		rndr.JSON(w, http.StatusUnprocessableEntity, renderer.M{
+			"errors": errs,
 		})
 		return
 	}
-	tm := todoModel{
-		ID: bson.ObjectIdHex(id),
-		Title:     t.Title,
-		Completed: t.Completed,
-		CreatedAt: t.CreatedAt,
+
+	// PUT can't change createdAt, so the due date is checked against the
+	// stored one.
+	warnings := []fieldError{}
+	if t.DueDate != nil {
+		var stored todoModel
+		selector := activeTodo(bson.ObjectIdHex(id))
+		if err := timeQuery(r.Context(), "findOne", selector, func() error {
+			return db.C(collectionName).Find(selector).Select(bson.M{"createdAt": 1}).One(&stored)
+		}); err != nil {
+			if err == mgo.ErrNotFound {
+				renderMissingTodo(w, r, bson.ObjectIdHex(id))
+				return
+			}
+			renderDBError(w, "Failed to update TODO", err)
+			return
+		}
+		t.CreatedAt = stored.CreatedAt
+		var errs []fieldError
+		if errs, warnings = checkDueDate(&t, strictDates(r)); len(errs) > 0 {
+			rndr.JSON(w, http.StatusUnprocessableEntity, renderer.M{
+				"errors": errs,
+			})
+			return
+		}
+	}
+
+	// PUT replaces the client-editable fields as a whole: an optional field
+	// left out of the body is cleared, where PATCH would keep it. The
+	// server-managed ones (createdAt, position) survive the update.
+	set := bson.M{
+		"title":     t.Title,
+		"completed": t.Completed,
+		"tags":      t.Tags,
+	}
+	unset := bson.M{}
+	optional := bson.M{
+		"description":     t.Description,
+		"assignee":        t.Assignee,
+		"estimateMinutes": t.EstimateMinutes,
+		"sortKey":         t.SortKey,
+		"priority":        priorityRanks[t.Priority],
+		"dueDate":         utcTime(t.DueDate),
+	}
+	if len(t.Metadata) > 0 {
+		set["metadata"] = t.Metadata
+	} else {
+		unset["metadata"] = ""
+	}
+	for field, v := range optional {
+		switch v {
+		case "", 0, (*time.Time)(nil):
+			unset[field] = ""
+		default:
+			set[field] = v
+		}
+	}
+	update := bson.M{"$set": set, "$unset": unset}
+	setCompletion(update, t.Completed)
+	setExpiry(update, t.Completed)
+
+	selector := activeTodo(bson.ObjectIdHex(id))
+	if err := timeQuery(r.Context(), "update", selector, func() error {
+		return db.C(collectionName).Update(selector, update)
+	}); err != nil {
+		if err == mgo.ErrNotFound {
+			renderMissingTodo(w, r, bson.ObjectIdHex(id))
+			return
+		}
+		renderDBError(w, "Failed to update TODO", err)
+		return
 	}
 
-	if err := db.C(collectionName).UpdateId(bson.ObjectIdHex(id), &tm);err!= nil{
-		if err1 := rndr.JSON(w, http.StatusProcessing, renderer.M{
-			"message": "Failed to update TODO",
-			"error":   err,
+	meta := renderer.M{
+		"message": "TODO updated successfully.",
+	}
+	if len(warnings) > 0 {
+		meta["warnings"] = warnings
+	}
+	respondOK(w, http.StatusOK, renderer.M{
+		"id": id,
+	}, meta)
+}
+
+func deleteTodo(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+
+	if !bson.IsObjectIdHex(id) {
+		if err1 := rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "Invalid URL request",
 		}); err1 != nil {
-			checkerr(err1)
+			renderFailed(err1)
 			return
 		}
 		return
 	}
-	if err := rndr.JSON(w, http.StatusOK, renderer.M{
-		"message":"TODO updated successfully.",
+
+	// Deleting only moves the todo to the trash; its comments are kept so
+	// that a restore brings everything back.
+	selector := activeTodo(bson.ObjectIdHex(id))
+	if err := timeQuery(r.Context(), "update", selector, func() error {
+		return db.C(collectionName).Update(selector, trashUpdate())
 	}); err != nil {
-		checkerr(err)
+		if err == mgo.ErrNotFound {
+			renderMissingTodo(w, r, bson.ObjectIdHex(id))
+			return
+		}
+		renderDBError(w, "Failed to remove TODO", err)
 		return
 	}
+	releasePins(r.Context(), bson.ObjectIdHex(id))
+
+	respondOK(w, http.StatusOK, renderer.M{
+		"id": id,
+	}, renderer.M{
+		"message": "TODO deleted successfully.",
+	})
 }
 
-func deleteTodo(w http.ResponseWriter, r *http.Request) {
+func archiveTodo(w http.ResponseWriter, r *http.Request) {
+	setArchived(w, r, true)
+}
+
+func unarchiveTodo(w http.ResponseWriter, r *http.Request) {
+	setArchived(w, r, false)
+}
+
+// setArchived moves a todo in or out of the archive without touching its
+// completion.
+func setArchived(w http.ResponseWriter, r *http.Request, archived bool) {
 	id := strings.TrimSpace(chi.URLParam(r, "id"))
 
 	if !bson.IsObjectIdHex(id) {
 		if err1 := rndr.JSON(w, http.StatusBadRequest, renderer.M{
 			"error": "Invalid URL request",
 		}); err1 != nil {
-			checkerr(err1)
+			renderFailed(err1)
 			return
 		}
 		return
 	}
 
-	if err := db.C(collectionName).RemoveId(bson.ObjectIdHex(id)); err != nil {
-		if err1 := rndr.JSON(w, http.StatusProcessing, renderer.M{
-			"message": "Failed to remove TODO",
-			"error":   err,
+	selector := activeTodo(bson.ObjectIdHex(id))
+	if err := timeQuery(r.Context(), "update", selector, func() error {
+		return db.C(collectionName).Update(selector, bson.M{"$set": bson.M{"archived": archived}})
+	}); err != nil {
+		if err == mgo.ErrNotFound {
+			renderMissingTodo(w, r, bson.ObjectIdHex(id))
+			return
+		}
+		renderDBError(w, "Failed to update TODO", err)
+		return
+	}
+
+	message := "TODO archived successfully."
+	if !archived {
+		message = "TODO unarchived successfully."
+	}
+	respondOK(w, http.StatusOK, renderer.M{
+		"id": id,
+	}, renderer.M{
+		"message": message,
+	})
+}
+
+func moveTodo(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+
+	if !bson.IsObjectIdHex(id) {
+		if err1 := rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "Invalid URL request",
 		}); err1 != nil {
-			checkerr(err1)
+			renderFailed(err1)
+			return
+		}
+		return
+	}
+
+	var m moveRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		renderBadBody(w, err)
+		return
+	}
+
+	m.After = strings.TrimSpace(m.After)
+	if (m.Position == nil) == (m.After == "") {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "Exactly one of position or after must be given",
+		})
+		return
+	}
+
+	c := db.C(collectionName)
+
+	var tm todoModel
+	selector := activeTodo(bson.ObjectIdHex(id))
+	if err := timeQuery(r.Context(), "findOne", selector, func() error {
+		return c.Find(selector).One(&tm)
+	}); err != nil {
+		if err == mgo.ErrNotFound {
+			renderMissingTodo(w, r, bson.ObjectIdHex(id))
 			return
 		}
+		renderDBError(w, "Failed to move TODO", err)
+		return
+	}
+
+	last, err := nextPosition(r.Context())
+	if err != nil {
+		renderDBError(w, "Failed to move TODO", err)
+		return
+	}
+	last--
+
+	target := 0
+	if m.Position != nil {
+		target = *m.Position
+		if target < 0 || target > last {
+			rndr.JSON(w, http.StatusBadRequest, renderer.M{
+				"error": "The position is out of range",
+			})
+			return
+		}
+	} else {
+		if !bson.IsObjectIdHex(m.After) || m.After == id {
+			rndr.JSON(w, http.StatusBadRequest, renderer.M{
+				"error": "Invalid after todo",
+			})
+			return
+		}
+		var after todoModel
+		selector := activeTodo(bson.ObjectIdHex(m.After))
+		if err := timeQuery(r.Context(), "findOne", selector, func() error {
+			return c.Find(selector).One(&after)
+		}); err != nil {
+			rndr.JSON(w, http.StatusBadRequest, renderer.M{
+				"error": "Invalid after todo",
+			})
+			return
+		}
+		// Moving down, the after todo itself shifts up one slot to fill the gap.
+		target = after.Position
+		if after.Position < tm.Position {
+			target++
+		}
+	}
+
+	// Trashed todos keep their old position and are left alone; a restore
+	// sends them to the end of the list.
+	positions := func(span bson.M) bson.M {
+		selector := notDeleted()
+		selector["position"] = span
+		return selector
+	}
+	shift := func(selector bson.M, by int) error {
+		return timeQuery(r.Context(), "updateAll", selector, func() error {
+			_, err := c.UpdateAll(selector, bson.M{"$inc": bson.M{"position": by}})
+			return err
+		})
+	}
+	from, to := tm.Position, target
+	switch {
+	case target < tm.Position:
+		err = shift(positions(bson.M{"$gte": target, "$lt": tm.Position}), 1)
+		from, to = target, tm.Position
+	case target > tm.Position:
+		err = shift(positions(bson.M{"$gt": tm.Position, "$lte": target}), -1)
+	}
+	if err == nil && target != tm.Position {
+		selector := bson.M{"_id": tm.ID}
+		err = timeQuery(r.Context(), "update", selector, func() error {
+			return c.Update(selector, bson.M{"$set": bson.M{"position": target}})
+		})
+	}
+	if err != nil {
+		renderDBError(w, "Failed to move TODO", err)
 		return
 	}
-	rndr.JSON(w, http.StatusOK, renderer.M{
-		"message":"TODO deleted successfully.",
+
+	affected := []todoModel{}
+	span := positions(bson.M{"$gte": from, "$lte": to})
+	if err := timeQuery(r.Context(), "find", span, func() error {
+		return c.Find(span).Sort("position").All(&affected)
+	}); err != nil {
+		renderDBError(w, "Failed to fetch moved TODOs", err)
+		return
+	}
+
+	moved := []todoPosition{}
+	for _, a := range affected {
+		moved = append(moved, todoPosition{ID: a.ID.Hex(), Position: a.Position})
+	}
+	respondOK(w, http.StatusOK, moved, renderer.M{
+		"message": "TODO moved successfully.",
 	})
 }
+
+// nextPosition returns the position one past the current last todo outside
+// the trash.
+func nextPosition(ctx context.Context) (int, error) {
+	var last todoModel
+	filter := notDeleted()
+	err := timeQuery(ctx, "find", filter, func() error {
+		return db.C(collectionName).Find(filter).Sort("-position").Select(bson.M{"position": 1}).One(&last)
+	})
+	if err == mgo.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return last.Position + 1, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testDB points db at a scratch database on the local Mongo for the tests
+// that need one, and skips the test when Mongo isn't running.
+func testDB(t *testing.T) {
+	t.Helper()
+	session, err := mgo.DialWithTimeout(hostName, time.Second)
+	if err != nil {
+		t.Skipf("Mongo isn't reachable at %s: %s", hostName, err)
+	}
+	session.SetMode(mgo.Monotonic, true)
+
+	prev := db
+	db = session.DB(dbName + "_test")
+	if err := db.DropDatabase(); err != nil {
+		session.Close()
+		db = prev
+		t.Fatal(err)
+	}
+	ensureIndexes()
+	t.Cleanup(func() {
+		db.DropDatabase()
+		session.Close()
+		db = prev
+	})
+}
+
+// serve runs one request through h and returns the recorded response.
+func serve(h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	var b io.Reader
+	if body != "" {
+		b = strings.NewReader(body)
+	}
+	r := httptest.NewRequest(method, target, b)
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// insertTodo stores tm in the test database, filling in what every stored
+// todo has, and returns its id.
+func insertTodo(t *testing.T, tm todoModel) bson.ObjectId {
+	t.Helper()
+	if tm.ID == "" {
+		tm.ID = bson.NewObjectId()
+	}
+	if tm.CreatedAt.IsZero() {
+		tm.CreatedAt = time.Now().UTC()
+	}
+	if tm.Tags == nil {
+		tm.Tags = []string{}
+	}
+	if err := db.C(collectionName).Insert(&tm); err != nil {
+		t.Fatal(err)
+	}
+	return tm.ID
+}
+
+// storedTodo reads a todo back from the test database.
+func storedTodo(t *testing.T, id bson.ObjectId) todoModel {
+	t.Helper()
+	var tm todoModel
+	if err := db.C(collectionName).FindId(id).One(&tm); err != nil {
+		t.Fatal(err)
+	}
+	return tm
+}
+
+// decodeBody decodes a JSON response body into v.
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("invalid JSON response %q: %s", w.Body.String(), err)
+	}
+}
+
+func TestZeroIDIsOmitted(t *testing.T) {
+	raw, err := bson.Marshal(todoModel{Title: "no id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := doc["_id"]; ok {
+		t.Errorf("a zero id is encoded as %v, want it left out", doc["_id"])
+	}
+
+	id := bson.NewObjectId()
+	raw, _ = bson.Marshal(todoModel{ID: id})
+	doc = bson.M{}
+	bson.Unmarshal(raw, &doc)
+	if doc["_id"] != id {
+		t.Errorf("_id = %v, want %v", doc["_id"], id)
+	}
+}
+
+// Struct tag options are separated by a bare comma; "_id, omitempty" would
+// silently drop the option.
+func TestStructTagsHaveNoSpaces(t *testing.T) {
+	for _, v := range []interface{}{todoModel{}, todo{}, commentModel{}, comment{}, attachmentModel{}, attachment{}, snapshot{}} {
+		typ := reflect.TypeOf(v)
+		for i := 0; i < typ.NumField(); i++ {
+			f := typ.Field(i)
+			for _, key := range []string{"bson", "json"} {
+				if tag := f.Tag.Get(key); strings.Contains(tag, " ") {
+					t.Errorf("%s.%s has %s tag %q with a space", typ.Name(), f.Name, key, tag)
+				}
+			}
+		}
+	}
+}
+
+// With the id left out, Mongo assigns one on insert, and an upsert on a
+// selector creates a document with an id of its own.
+func TestZeroIDOnInsertAndUpsert(t *testing.T) {
+	testDB(t)
+	c := db.C(collectionName)
+
+	if err := c.Insert(todoModel{Title: "inserted", Tags: []string{}}); err != nil {
+		t.Fatal(err)
+	}
+	var tm todoModel
+	if err := c.Find(bson.M{"title": "inserted"}).One(&tm); err != nil {
+		t.Fatal(err)
+	}
+	if !tm.ID.Valid() {
+		t.Errorf("inserted todo got id %q, want a generated ObjectId", tm.ID)
+	}
+
+	if _, err := c.Upsert(bson.M{"title": "upserted"}, todoModel{Title: "upserted", Tags: []string{}}); err != nil {
+		t.Fatal(err)
+	}
+	tm = todoModel{}
+	if err := c.Find(bson.M{"title": "upserted"}).One(&tm); err != nil {
+		t.Fatal(err)
+	}
+	if !tm.ID.Valid() {
+		t.Errorf("upserted todo got id %q, want a generated ObjectId", tm.ID)
+	}
+}
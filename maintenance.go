@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi"
+	"github.com/thedevsaddam/renderer"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+// maintenanceRetryAfter is the Retry-After, in seconds, sent with mutations
+// rejected during maintenance.
+const maintenanceRetryAfter int = 120
+
+// maintenance is 1 while mutations are rejected. It's read on every request
+// and flipped at runtime from /admin/maintenance, hence the atomic access.
+var maintenance int32
+
+func inMaintenance() bool {
+	return atomic.LoadInt32(&maintenance) == 1
+}
+
+func setMaintenance(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&maintenance, v)
+}
+
+// readOnlyPosts are the POST routes of the todo router that only read,
+// taking a body because their input doesn't fit a query string.
+var readOnlyPosts = map[string]bool{
+	"/search":   true,
+	"/validate": true,
+}
+
+// readOnly reports whether r can't change any todo.
+func readOnly(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	case http.MethodPost:
+		rctx := chi.RouteContext(r.Context())
+		return rctx != nil && readOnlyPosts[rctx.RoutePath]
+	}
+	return false
+}
+
+// maintenanceGuard rejects every mutating request with a 503 while
+// maintenance mode is on; reads keep working.
+func maintenanceGuard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !readOnly(r) && inMaintenance() {
+			w.Header().Set("Retry-After", strconv.Itoa(maintenanceRetryAfter))
+			rndr.JSON(w, http.StatusServiceUnavailable, renderer.M{
+				"error": "The service is under maintenance, changes are disabled for now. Please retry later.",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func fetchMaintenance(w http.ResponseWriter, r *http.Request) {
+	respondOK(w, http.StatusOK, renderer.M{
+		"enabled": inMaintenance(),
+	}, nil)
+}
+
+func updateMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		renderBadBody(w, err)
+		return
+	}
+
+	setMaintenance(req.Enabled)
+
+	respondOK(w, http.StatusOK, renderer.M{
+		"enabled": req.Enabled,
+	}, renderer.M{
+		"message": "Maintenance mode updated successfully.",
+	})
+}
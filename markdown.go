@@ -0,0 +1,21 @@
+package main
+
+import (
+	"bytes"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+)
+
+// markdownPolicy is the sanitizer applied to rendered descriptions. The UGC
+// policy keeps ordinary formatting and links but drops scripts, event
+// handlers and other markup that would allow stored XSS.
+var markdownPolicy = bluemonday.UGCPolicy()
+
+// renderMarkdown renders a Markdown description to sanitized HTML.
+func renderMarkdown(src string) (string, error) {
+	var buf bytes.Buffer
+	if err := goldmark.Convert([]byte(src), &buf); err != nil {
+		return "", err
+	}
+	return markdownPolicy.Sanitize(buf.String()), nil
+}
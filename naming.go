@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/thedevsaddam/renderer"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+const (
+	namingCamel string = "camel"
+	namingSnake string = "snake"
+)
+
+// parseNaming reads ?naming=, defaulting to cfg.naming.
+func parseNaming(r *http.Request) (string, error) {
+	switch naming := r.URL.Query().Get("naming"); naming {
+	case "":
+		return cfg.naming, nil
+	case namingCamel, namingSnake:
+		return naming, nil
+	default:
+		return "", errors.New("Invalid naming " + naming + ", expected camel or snake")
+	}
+}
+
+// camelToSnake turns "createdAt" into "created_at".
+func camelToSnake(s string) string {
+	var b strings.Builder
+	for i, c := range s {
+		if unicode.IsUpper(c) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			c = unicode.ToLower(c)
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// snakeToCamel turns "created_at" into "createdAt". Keys with a leading
+// underscore such as "_id" are left alone.
+func snakeToCamel(s string) string {
+	if strings.HasPrefix(s, "_") || !strings.Contains(s, "_") {
+		return s
+	}
+	parts := strings.Split(s, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// freeFormKeys are the fields whose value is a map of keys chosen by the
+// client, such as metadata. Those keys are data, not field names, so they
+// go through unrenamed in both directions.
+var freeFormKeys = map[string]bool{
+	"metadata": true,
+}
+
+// renameKeys renames the object keys of a decoded JSON document, except
+// inside the fields listed in freeFormKeys.
+func renameKeys(v interface{}, rename func(string) string) interface{} {
+	switch doc := v.(type) {
+	case map[string]interface{}:
+		renamed := make(map[string]interface{}, len(doc))
+		for k, val := range doc {
+			k = rename(k)
+			if freeFormKeys[k] {
+				renamed[k] = val
+				continue
+			}
+			renamed[k] = renameKeys(val, rename)
+		}
+		return renamed
+	case []interface{}:
+		for i, val := range doc {
+			doc[i] = renameKeys(val, rename)
+		}
+		return doc
+	default:
+		return v
+	}
+}
+
+// transformJSON decodes raw, renames its keys and encodes it again. Numbers
+// are kept verbatim so that large integers don't go through float64.
+func transformJSON(raw []byte, rename func(string) string) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	var doc interface{}
+	if err := d.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(renameKeys(doc, rename))
+}
+
+// isJSON reports whether a Content-Type is JSON; an empty one counts since
+// handlers decode bodies regardless of it.
+func isJSON(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/json"
+}
+
+// strictJSON rejects write requests whose body isn't declared as
+// application/json with a 415 when STRICT_CONTENT_TYPE is on. Bodiless
+// writes such as POST /todo/{id}/archive pass.
+func strictJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			if !cfg.strictContentType || r.ContentLength == 0 {
+				break
+			}
+			if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+				rndr.JSON(w, http.StatusUnsupportedMediaType, renderer.M{
+					"error": "The request body must be sent as application/json",
+				})
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// namingKey is the context key of the *namingState of a request.
+type namingKey struct{}
+
+// namingState is the response naming fieldNaming settled on, and whether
+// the handler took over renaming its own response.
+type namingState struct {
+	naming   string
+	streamed bool
+}
+
+// streamedNaming is for handlers that stream their response, which
+// fieldNaming would otherwise buffer in full to rename it. It returns the
+// renaming the response's keys need, nil for camelCase, and has
+// fieldNaming pass the response through as written. It must be called
+// before the response is started.
+func streamedNaming(r *http.Request) func(string) string {
+	s, ok := r.Context().Value(namingKey{}).(*namingState)
+	if !ok {
+		return nil
+	}
+	s.streamed = true
+	if s.naming == namingSnake {
+		return camelToSnake
+	}
+	return nil
+}
+
+// encodeNamed writes v as JSON with its keys renamed by rename, when set.
+func encodeNamed(w io.Writer, v interface{}, rename func(string) string) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if rename != nil {
+		if b, err = transformJSON(b, rename); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// namingWriter buffers a snake_case response for fieldNaming to rename,
+// unless the handler called streamedNaming, in which case it passes the
+// response through.
+type namingWriter struct {
+	recorder
+	w     http.ResponseWriter
+	state *namingState
+	// passing is set once a streamed response has started.
+	passing bool
+}
+
+func (nw *namingWriter) Header() http.Header {
+	if nw.passing {
+		return nw.w.Header()
+	}
+	return nw.recorder.Header()
+}
+
+func (nw *namingWriter) WriteHeader(status int) {
+	if !nw.state.streamed {
+		nw.recorder.WriteHeader(status)
+		return
+	}
+	if !nw.passing {
+		nw.passing = true
+		for k, v := range nw.recorder.header {
+			nw.w.Header()[k] = v
+		}
+	}
+	nw.w.WriteHeader(status)
+}
+
+func (nw *namingWriter) Write(b []byte) (int, error) {
+	if !nw.state.streamed {
+		return nw.recorder.Write(b)
+	}
+	if !nw.passing {
+		nw.WriteHeader(http.StatusOK)
+	}
+	return nw.w.Write(b)
+}
+
+// fieldNaming accepts snake_case keys in JSON request bodies and, when
+// snake_case is asked for through ?naming= or JSON_NAMING, renders JSON
+// responses with snake_case keys. Snake case responses are buffered, so
+// they lose streaming, except those of handlers that rename their own
+// through streamedNaming, such as the export. camelCase ones pass straight
+// through.
+func fieldNaming(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		naming, err := parseNaming(r)
+		if err != nil {
+			rndr.JSON(w, http.StatusBadRequest, renderer.M{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// Every body is bounded here, as the renaming below is the first
+		// thing to read it.
+		if r.ContentLength > cfg.maxBodyBytes {
+			renderBodyTooLarge(w)
+			return
+		}
+		if r.Body != nil {
+			r.Body = limitBody(r.Body)
+		}
+		if r.Body != nil && isJSON(r.Header.Get("Content-Type")) {
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				renderBadBody(w, err)
+				return
+			}
+			// A body that isn't JSON is left for the handler to reject.
+			if renamed, err := transformJSON(body, snakeToCamel); err == nil {
+				body = renamed
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			r.ContentLength = int64(len(body))
+		}
+
+		state := &namingState{naming: naming}
+		r = r.WithContext(context.WithValue(r.Context(), namingKey{}, state))
+		if naming != namingSnake {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		nw := &namingWriter{recorder: recorder{header: http.Header{}}, w: w, state: state}
+		next.ServeHTTP(nw, r)
+		if state.streamed {
+			return
+		}
+
+		rec := &nw.recorder
+
+		body := rec.body.Bytes()
+		if isJSON(rec.header.Get("Content-Type")) && len(body) > 0 {
+			if renamed, err := transformJSON(body, camelToSnake); err == nil {
+				body = renamed
+			}
+		}
+		for k, v := range rec.header {
+			w.Header()[k] = v
+		}
+		if rec.status != 0 {
+			w.WriteHeader(rec.status)
+		}
+		w.Write(body)
+	})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Metadata keys belong to the client: neither direction may rename them,
+// so a snake_case client reads back exactly the keys it wrote.
+func TestRenameKeysLeavesMetadataAlone(t *testing.T) {
+	metadata := map[string]interface{}{
+		"jira_key":   "WEB-12",
+		"sourceApp":  "slack",
+		"plain":      "x",
+		"_private":   "y",
+		"nested_key": "z",
+	}
+	request := map[string]interface{}{
+		"due_date": "2026-10-14",
+		"metadata": metadata,
+	}
+	raw, _ := json.Marshal([]interface{}{request})
+
+	camel, err := transformJSON(raw, snakeToCamel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []map[string]interface{}
+	json.Unmarshal(camel, &decoded)
+	if _, ok := decoded[0]["dueDate"]; !ok {
+		t.Errorf("request keys weren't renamed: %s", camel)
+	}
+	if !reflect.DeepEqual(decoded[0]["metadata"], metadata) {
+		t.Errorf("request metadata = %v, want %v", decoded[0]["metadata"], metadata)
+	}
+
+	snake, err := transformJSON(camel, camelToSnake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded = nil
+	json.Unmarshal(snake, &decoded)
+	if !reflect.DeepEqual(decoded[0], request) {
+		t.Errorf("round trip = %v, want %v", decoded[0], request)
+	}
+}
+
+func TestFieldNamingBuffersUnstreamedResponses(t *testing.T) {
+	h := fieldNaming(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Total-Count", "1")
+		respondOK(w, http.StatusCreated, map[string]string{"createdAt": "now"}, nil)
+	}))
+	w := serve(h, http.MethodGet, "/todo?naming=snake", "")
+	if w.Code != http.StatusCreated || w.Header().Get("X-Total-Count") != "1" {
+		t.Errorf("response = %d %v, want the handler's status and headers", w.Code, w.Header())
+	}
+	if got, want := strings.TrimSpace(w.Body.String()), `{"data":{"created_at":"now"}}`; got != want {
+		t.Errorf("body = %s, want %s", got, want)
+	}
+}
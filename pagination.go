@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/thedevsaddam/renderer"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// parsePagination reads ?limit= and ?offset= for every list endpoint. A
+// missing or 0 limit falls back to defaultLimit, or cfg.defaultPageSize
+// when that's 0 too, and any limit is clamped to cfg.maxPageSize, so the
+// returned limit is never 0.
+func parsePagination(r *http.Request, defaultLimit int) (limit, offset int, err error) {
+	query := r.URL.Query()
+
+	if v := query.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			return 0, 0, errors.New("The limit must be a non-negative integer")
+		}
+	}
+	if limit == 0 {
+		limit = defaultLimit
+	}
+	if limit == 0 {
+		limit = cfg.defaultPageSize
+	}
+	if cfg.maxPageSize > 0 && limit > cfg.maxPageSize {
+		limit = cfg.maxPageSize
+	}
+
+	if v := query.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return 0, 0, errors.New("The offset must be a non-negative integer")
+		}
+	}
+
+	return limit, offset, nil
+}
+
+// parseSort resolves ?sort= (prefix "-" for descending) to an mgo sort
+// field, defaulting to the manual position order. Lists add _id after it so
+// that todos sharing a value keep the same order from one page to the next.
+func parseSort(r *http.Request) (string, error) {
+	s := strings.TrimSpace(r.URL.Query().Get("sort"))
+	if s == "" {
+		return "position", nil
+	}
+
+	desc := strings.HasPrefix(s, "-")
+	f, ok := queryFields[strings.TrimPrefix(s, "-")]
+	if !ok || !f.sortable {
+		return "", errors.New("Cannot sort by " + s)
+	}
+	if !f.indexed {
+		log.Printf("level=warn msg=\"sorting on a field without an index\" field=%s", f.bson)
+	}
+	if desc {
+		return "-" + f.bson, nil
+	}
+	return f.bson, nil
+}
+
+// hasMore reports whether a page leaves results after it.
+func hasMore(total, limit, offset int) bool {
+	return limit > 0 && offset+limit < total
+}
+
+// pageMeta is the meta of a list page. hasMore tells clients they didn't get
+// everything, whether or not they asked for a limit.
+func pageMeta(total, limit, offset int) renderer.M {
+	return renderer.M{
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+		"hasMore": hasMore(total, limit, offset),
+	}
+}
+
+// setPaginationHeaders sets X-Total-Count, X-Result-Truncated when more
+// results follow the page and, for a limited page, an RFC 5988 Link header.
+// The links keep the request's other query params so that they page
+// through the same filtered list.
+func setPaginationHeaders(w http.ResponseWriter, r *http.Request, total, limit, offset int) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	if limit == 0 {
+		return
+	}
+	if hasMore(total, limit, offset) {
+		w.Header().Set("X-Result-Truncated", "true")
+	}
+
+	last := 0
+	if total > 0 {
+		last = (total - 1) / limit * limit
+	}
+
+	links := []string{pageLink(r, 0, limit, "first")}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		links = append(links, pageLink(r, prev, limit, "prev"))
+	}
+	if offset+limit < total {
+		links = append(links, pageLink(r, offset+limit, limit, "next"))
+	}
+	links = append(links, pageLink(r, last, limit, "last"))
+
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
+
+func pageLink(r *http.Request, offset, limit int, rel string) string {
+	u := *r.URL
+	query := u.Query()
+	query.Set("offset", strconv.Itoa(offset))
+	query.Set("limit", strconv.Itoa(limit))
+	u.RawQuery = query.Encode()
+	return fmt.Sprintf("<%s>; rel=%q", u.RequestURI(), rel)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParsePagination(t *testing.T) {
+	defer func(def, max int) { cfg.defaultPageSize, cfg.maxPageSize = def, max }(cfg.defaultPageSize, cfg.maxPageSize)
+	cfg.defaultPageSize, cfg.maxPageSize = 50, 100
+
+	tests := []struct {
+		query         string
+		defaultLimit  int
+		limit, offset int
+		valid         bool
+	}{
+		{"", 0, 50, 0, true},
+		{"limit=0", 0, 50, 0, true},
+		{"", 20, 20, 0, true},
+		{"limit=0", 20, 20, 0, true},
+		{"limit=1", 20, 1, 0, true},
+		{"limit=100", 20, 100, 0, true},
+		{"limit=101", 20, 100, 0, true},
+		{"limit=1000000", 0, 100, 0, true},
+		{"", 500, 100, 0, true},
+		{"limit=-1", 20, 0, 0, false},
+		{"limit=ten", 20, 0, 0, false},
+		{"offset=0", 0, 50, 0, true},
+		{"offset=250", 0, 50, 250, true},
+		{"offset=-1", 0, 0, 0, false},
+		{"limit=10&offset=-1", 0, 0, 0, false},
+		{"limit=10&offset=30", 0, 10, 30, true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/todo?"+tt.query, nil)
+		limit, offset, err := parsePagination(r, tt.defaultLimit)
+		if (err == nil) != tt.valid {
+			t.Errorf("parsePagination(%q, %d) error = %v, want valid %v", tt.query, tt.defaultLimit, err, tt.valid)
+			continue
+		}
+		if limit != tt.limit || offset != tt.offset {
+			t.Errorf("parsePagination(%q, %d) = %d, %d, want %d, %d", tt.query, tt.defaultLimit, limit, offset, tt.limit, tt.offset)
+		}
+	}
+}
+
+func TestParsePaginationClampsTheDefaultPageSize(t *testing.T) {
+	defer func(def, max int) { cfg.defaultPageSize, cfg.maxPageSize = def, max }(cfg.defaultPageSize, cfg.maxPageSize)
+	cfg.defaultPageSize, cfg.maxPageSize = 1000, 100
+
+	r := httptest.NewRequest("GET", "/todo", nil)
+	if limit, _, err := parsePagination(r, 0); err != nil || limit != 100 {
+		t.Errorf("parsePagination() = %d, %v, want the default clamped to 100", limit, err)
+	}
+}
+
+func TestParsePaginationWithoutCap(t *testing.T) {
+	defer func(max int) { cfg.maxPageSize = max }(cfg.maxPageSize)
+	cfg.maxPageSize = 0
+
+	r := httptest.NewRequest("GET", "/todo?limit=100000", nil)
+	if limit, _, err := parsePagination(r, 0); err != nil || limit != 100000 {
+		t.Errorf("parsePagination() = %d, %v, want 100000 with MAX_PAGE_SIZE=0", limit, err)
+	}
+}
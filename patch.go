@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi"
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// patchTodo changes only the fields present in the body, unlike PUT which
+// clears the ones left out. The patch is
+// applied to the stored todo first and the result is validated as a whole,
+// so a combination of fields that would leave the todo inconsistent is
+// rejected before anything is written.
+func patchTodo(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+
+	if !bson.IsObjectIdHex(id) {
+		if err1 := rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "Invalid URL request",
+		}); err1 != nil {
+			renderFailed(err1)
+			return
+		}
+		return
+	}
+
+	body, ok := readValidBody(w, r, todoPatchSchema)
+	if !ok {
+		return
+	}
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(body, &patch); err != nil {
+		renderBadBody(w, err)
+		return
+	}
+
+	var tm todoModel
+	selector := activeTodo(bson.ObjectIdHex(id))
+	if err := timeQuery(r.Context(), "findOne", selector, func() error {
+		return db.C(collectionName).Find(selector).One(&tm)
+	}); err != nil {
+		if err == mgo.ErrNotFound {
+			renderMissingTodo(w, r, bson.ObjectIdHex(id))
+			return
+		}
+		renderDBError(w, "Failed to fetch todo", err)
+		return
+	}
+
+	t := toTodo(tm, time.UTC)
+	// Unmarshal would merge a patched metadata object into the stored map;
+	// it replaces it like any other field.
+	if _, ok := patch["metadata"]; ok {
+		t.Metadata = nil
+	}
+	if err := json.Unmarshal(body, &t); err != nil {
+		rndr.JSON(w, http.StatusUnprocessableEntity, renderer.M{
+			"errors": []fieldError{decodeFieldError(err)},
+		})
+		return
+	}
+	errs, warnings := validatePatch(patch, &t, strictDates(r))
+	if len(errs) > 0 {
+		rndr.JSON(w, http.StatusUnprocessableEntity, renderer.M{
+			"errors": errs,
+		})
+		return
+	}
+
+	update := patchUpdate(patch, t)
+	if err := timeQuery(r.Context(), "update", selector, func() error {
+		return db.C(collectionName).Update(selector, update)
+	}); err != nil {
+		if err == mgo.ErrNotFound {
+			renderMissingTodo(w, r, bson.ObjectIdHex(id))
+			return
+		}
+		renderDBError(w, "Failed to update TODO", err)
+		return
+	}
+
+	meta := renderer.M{
+		"message": "TODO updated successfully.",
+	}
+	if len(warnings) > 0 {
+		meta["warnings"] = warnings
+	}
+	respondOK(w, http.StatusOK, renderer.M{
+		"id": id,
+	}, meta)
+}
+
+// validatePatch normalizes and checks the patched todo t: the per-field rules of
+// validateTodo plus the rules tying completed, completedAt, dueDate and
+// createdAt together. Warnings point out allowed but suspicious states.
+func validatePatch(patch map[string]json.RawMessage, t *todo, strict bool) (errs, warnings []fieldError) {
+	errs = validateTodo(t)
+	warnings = []fieldError{}
+
+	if _, ok := patch["dueDate"]; ok {
+		dueErrs, dueWarnings := checkDueDate(t, strict)
+		errs = append(errs, dueErrs...)
+		warnings = append(warnings, dueWarnings...)
+	}
+
+	_, setsCompletedAt := patch["completedAt"]
+	if setsCompletedAt {
+		switch {
+		case t.Completed && t.CompletedAt == nil:
+			errs = append(errs, fieldError{Field: "completedAt", Message: "The completion time of a completed TODO cannot be cleared"})
+		case !t.Completed && t.CompletedAt != nil:
+			errs = append(errs, fieldError{Field: "completedAt", Message: "An open TODO cannot have a completion time"})
+		case t.CompletedAt != nil && t.CompletedAt.After(time.Now()):
+			errs = append(errs, fieldError{Field: "completedAt", Message: "The completion time cannot be in the future"})
+		}
+	}
+
+	if !t.Completed && t.DueDate != nil && t.DueDate.Before(time.Now()) {
+		warnings = append(warnings, fieldError{Field: "dueDate", Message: "The due date is in the past"})
+	}
+
+	for i := range errs {
+		errs[i].Pointer = "/" + errs[i].Field
+	}
+	for i := range warnings {
+		warnings[i].Pointer = "/" + warnings[i].Field
+	}
+	return errs, warnings
+}
+
+// patchUpdate builds the $set/$unset update of the fields present in patch
+// from the validated, patched todo t.
+func patchUpdate(patch map[string]json.RawMessage, t todo) bson.M {
+	set := bson.M{}
+	update := bson.M{"$set": set}
+	unset := func(field string) {
+		u, ok := update["$unset"].(bson.M)
+		if !ok {
+			u = bson.M{}
+			update["$unset"] = u
+		}
+		u[field] = ""
+	}
+
+	for field := range patch {
+		switch field {
+		case "title":
+			set["title"] = t.Title
+		case "description":
+			set["description"] = t.Description
+		case "completed":
+			set["completed"] = t.Completed
+		case "assignee":
+			set["assignee"] = t.Assignee
+		case "tags":
+			set["tags"] = t.Tags
+		case "estimateMinutes":
+			set["estimateMinutes"] = t.EstimateMinutes
+		case "sortKey":
+			set["sortKey"] = t.SortKey
+		case "priority":
+			set["priority"] = priorityRanks[t.Priority]
+		case "metadata":
+			if len(t.Metadata) > 0 {
+				set["metadata"] = t.Metadata
+			} else {
+				unset("metadata")
+			}
+		case "dueDate":
+			if t.DueDate != nil {
+				set["dueDate"] = utcTime(t.DueDate)
+			} else {
+				unset("dueDate")
+			}
+		case "completedAt":
+			if t.CompletedAt != nil {
+				set["completedAt"] = utcTime(t.CompletedAt)
+			} else {
+				unset("completedAt")
+			}
+		}
+	}
+
+	if _, ok := patch["completed"]; ok {
+		if _, ok := patch["completedAt"]; !ok {
+			setCompletion(update, t.Completed)
+		}
+		setExpiry(update, t.Completed)
+	}
+	if len(set) == 0 {
+		delete(update, "$set")
+	}
+	return update
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// At most cfg.maxPinned todos are pinned at a time. Counting the pinned
+// todos before pinning one lets concurrent pins overshoot, so every pin
+// first reserves a slot in a single list document, with an update that
+// only matches while the list has room. Todos moved to the trash are
+// unpinned and leave the list. connectDB rebuilds the list from the todos,
+// which also takes out ids a crash or the completed TTL left behind.
+
+// pinsID is the id of the pin list document in pinsName.
+const pinsID string = "pinned"
+
+type pinList struct {
+	ID  string          `bson:"_id"`
+	IDs []bson.ObjectId `bson:"ids"`
+}
+
+func pinTodo(w http.ResponseWriter, r *http.Request) {
+	setPinned(w, r, true)
+}
+
+func unpinTodo(w http.ResponseWriter, r *http.Request) {
+	setPinned(w, r, false)
+}
+
+func setPinned(w http.ResponseWriter, r *http.Request, pinned bool) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+
+	if !bson.IsObjectIdHex(id) {
+		if err1 := rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "Invalid URL request",
+		}); err1 != nil {
+			renderFailed(err1)
+			return
+		}
+		return
+	}
+
+	if pinned {
+		ok, err := reservePin(r.Context(), bson.ObjectIdHex(id))
+		if err != nil {
+			renderDBError(w, "Failed to pin TODO", err)
+			return
+		}
+		if !ok {
+			rndr.JSON(w, http.StatusConflict, renderer.M{
+				"error": fmt.Sprintf("At most %d TODOs can be pinned, unpin one first", cfg.maxPinned),
+			})
+			return
+		}
+	}
+
+	selector := activeTodo(bson.ObjectIdHex(id))
+	if err := timeQuery(r.Context(), "update", selector, func() error {
+		return db.C(collectionName).Update(selector, bson.M{"$set": bson.M{"pinned": pinned}})
+	}); err != nil {
+		if err == mgo.ErrNotFound {
+			// A missing or trashed todo isn't pinned, so its slot can go.
+			releasePins(r.Context(), bson.ObjectIdHex(id))
+			renderMissingTodo(w, r, bson.ObjectIdHex(id))
+			return
+		}
+		// The update may still have gone through; the slot is kept rather
+		// than risk freeing the one of a pinned todo.
+		renderDBError(w, "Failed to update TODO", err)
+		return
+	}
+	if !pinned {
+		releasePins(r.Context(), bson.ObjectIdHex(id))
+	}
+
+	message := "TODO pinned successfully."
+	if !pinned {
+		message = "TODO unpinned successfully."
+	}
+	respondOK(w, http.StatusOK, renderer.M{
+		"id": id,
+	}, renderer.M{
+		"message": message,
+	})
+}
+
+// reservePin adds id to the pin list, reporting false when the list is
+// full. A todo that is already in the list keeps its slot.
+func reservePin(ctx context.Context, id bson.ObjectId) (bool, error) {
+	if cfg.maxPinned <= 0 {
+		return false, nil
+	}
+
+	for retry := true; ; retry = false {
+		// The upsert creates the list when it's missing; on a full list the
+		// selector doesn't match and the insert it falls back to collides
+		// on the _id.
+		selector := bson.M{
+			"_id":                                  pinsID,
+			fmt.Sprintf("ids.%d", cfg.maxPinned-1): bson.M{"$exists": false},
+		}
+		err := timeQuery(ctx, "upsert", selector, func() error {
+			_, err := db.C(pinsName).Upsert(selector, bson.M{"$addToSet": bson.M{"ids": id}})
+			return err
+		})
+		if !mgo.IsDup(err) {
+			return err == nil, err
+		}
+
+		member := bson.M{"_id": pinsID, "ids": id}
+		var n int
+		err = timeQuery(ctx, "count", member, func() (err error) {
+			n, err = db.C(pinsName).Find(member).Count()
+			return err
+		})
+		if err != nil || n > 0 {
+			return n > 0, err
+		}
+		if !retry {
+			return false, nil
+		}
+		if err := prunePins(ctx); err != nil {
+			return false, err
+		}
+	}
+}
+
+// releasePins takes ids out of the pin list. A failure only leaves a slot
+// taken until the next prune, so it's logged rather than reported.
+func releasePins(ctx context.Context, ids ...bson.ObjectId) {
+	if len(ids) == 0 {
+		return
+	}
+	selector := bson.M{"_id": pinsID}
+	err := timeQuery(ctx, "update", selector, func() error {
+		return db.C(pinsName).Update(selector, bson.M{"$pullAll": bson.M{"ids": ids}})
+	})
+	if err != nil && err != mgo.ErrNotFound {
+		log.Printf("level=error msg=\"failed to release pins\" error=%q", err)
+	}
+}
+
+// prunePins takes the ids of todos that no longer exist or are in the trash
+// out of the pin list. A todo whose pin is still being set is active, so
+// its reservation stays.
+func prunePins(ctx context.Context) error {
+	var list pinList
+	selector := bson.M{"_id": pinsID}
+	if err := timeQuery(ctx, "findOne", selector, func() error {
+		return db.C(pinsName).Find(selector).One(&list)
+	}); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+
+	var active []struct {
+		ID bson.ObjectId `bson:"_id"`
+	}
+	filter := notDeleted()
+	filter["_id"] = bson.M{"$in": list.IDs}
+	if err := timeQuery(ctx, "find", filter, func() error {
+		return db.C(collectionName).Find(filter).Select(bson.M{"_id": 1}).All(&active)
+	}); err != nil {
+		return err
+	}
+	keep := map[bson.ObjectId]bool{}
+	for _, a := range active {
+		keep[a.ID] = true
+	}
+	stale := []bson.ObjectId{}
+	for _, id := range list.IDs {
+		if !keep[id] {
+			stale = append(stale, id)
+		}
+	}
+	releasePins(ctx, stale...)
+	return nil
+}
+
+// syncPins rebuilds the pin list from the pinned todos outside the trash.
+// It runs at startup, before any pin can be in flight on this server.
+func syncPins() error {
+	var pinned []struct {
+		ID bson.ObjectId `bson:"_id"`
+	}
+	filter := notDeleted()
+	filter["pinned"] = true
+	if err := db.C(collectionName).Find(filter).Select(bson.M{"_id": 1}).All(&pinned); err != nil {
+		return err
+	}
+	ids := []bson.ObjectId{}
+	for _, p := range pinned {
+		ids = append(ids, p.ID)
+	}
+	_, err := db.C(pinsName).UpsertId(pinsID, bson.M{"$set": bson.M{"ids": ids}})
+	return err
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func withMaxPinned(t *testing.T, n int) {
+	prev := cfg.maxPinned
+	cfg.maxPinned = n
+	t.Cleanup(func() { cfg.maxPinned = prev })
+}
+
+func pinnedCount(t *testing.T) int {
+	t.Helper()
+	filter := notDeleted()
+	filter["pinned"] = true
+	n, err := db.C(collectionName).Find(filter).Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// Concurrent pins can't get past MAX_PINNED.
+func TestPinCapUnderConcurrency(t *testing.T) {
+	testDB(t)
+	withMaxPinned(t, 3)
+	h := todoHandler()
+
+	const n = 20
+	paths := []string{}
+	for i := 0; i < n; i++ {
+		paths = append(paths, "/"+insertTodo(t, todoModel{Title: fmt.Sprint("todo ", i)}).Hex()+"/pin")
+	}
+
+	var wg sync.WaitGroup
+	codes := make([]int, n)
+	for i := range paths {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = serve(h, http.MethodPost, paths[i], "").Code
+		}(i)
+	}
+	wg.Wait()
+
+	ok := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusOK:
+			ok++
+		case http.StatusConflict:
+		default:
+			t.Errorf("pin = %d, want 200 or 409", code)
+		}
+	}
+	if ok != 3 || pinnedCount(t) != 3 {
+		t.Errorf("%d pins succeeded and %d todos are pinned, want 3", ok, pinnedCount(t))
+	}
+}
+
+func TestPinSlotsAreReleased(t *testing.T) {
+	testDB(t)
+	withMaxPinned(t, 1)
+	h := todoHandler()
+	first := insertTodo(t, todoModel{Title: "first"}).Hex()
+	second := insertTodo(t, todoModel{Title: "second"}).Hex()
+
+	if w := serve(h, http.MethodPost, "/"+first+"/pin", ""); w.Code != http.StatusOK {
+		t.Fatalf("pin = %d %s, want 200", w.Code, w.Body)
+	}
+	if w := serve(h, http.MethodPost, "/"+first+"/pin", ""); w.Code != http.StatusOK {
+		t.Errorf("pinning a pinned todo again = %d, want 200", w.Code)
+	}
+	if w := serve(h, http.MethodPost, "/"+second+"/pin", ""); w.Code != http.StatusConflict {
+		t.Errorf("pin past the cap = %d, want 409", w.Code)
+	}
+
+	// Unpinning and trashing both free the slot.
+	if w := serve(h, http.MethodPost, "/"+first+"/unpin", ""); w.Code != http.StatusOK {
+		t.Fatalf("unpin = %d %s, want 200", w.Code, w.Body)
+	}
+	if w := serve(h, http.MethodPost, "/"+second+"/pin", ""); w.Code != http.StatusOK {
+		t.Fatalf("pin after unpin = %d %s, want 200", w.Code, w.Body)
+	}
+	if w := serve(h, http.MethodDelete, "/"+second, ""); w.Code != http.StatusOK {
+		t.Fatalf("DELETE = %d %s, want 200", w.Code, w.Body)
+	}
+	if w := serve(h, http.MethodPost, "/"+first+"/pin", ""); w.Code != http.StatusOK {
+		t.Errorf("pin after trashing the pinned todo = %d %s, want 200", w.Code, w.Body)
+	}
+}
+
+// A slot left behind by a todo removed without going through the API, as
+// the completed TTL does, is reclaimed once the list is full.
+func TestPinPrunesRemovedTodos(t *testing.T) {
+	testDB(t)
+	withMaxPinned(t, 1)
+	h := todoHandler()
+	gone := insertTodo(t, todoModel{Title: "gone"})
+	other := insertTodo(t, todoModel{Title: "other"}).Hex()
+
+	if w := serve(h, http.MethodPost, "/"+gone.Hex()+"/pin", ""); w.Code != http.StatusOK {
+		t.Fatalf("pin = %d %s, want 200", w.Code, w.Body)
+	}
+	if err := db.C(collectionName).RemoveId(gone); err != nil {
+		t.Fatal(err)
+	}
+	if w := serve(h, http.MethodPost, "/"+other+"/pin", ""); w.Code != http.StatusOK {
+		t.Errorf("pin = %d %s, want 200 once the removed todo's slot is pruned", w.Code, w.Body)
+	}
+}
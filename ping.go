@@ -0,0 +1,51 @@
+package main
+
+import (
+	"github.com/thedevsaddam/renderer"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// pingTimeout bounds the round trip of GET /ping, so a probe never hangs on
+// an unreachable database.
+const pingTimeout = 2 * time.Second
+
+// pingDB measures one ping command against Mongo, for latency graphs. It
+// runs on its own session copy so its short timeouts don't leak into the
+// requests sharing the main one.
+func pingDB(w http.ResponseWriter, r *http.Request) {
+	session := db.Session.Copy()
+	defer session.Close()
+	session.SetSyncTimeout(pingTimeout)
+	session.SetSocketTimeout(pingTimeout)
+
+	start := time.Now()
+	err := session.Ping()
+	latency := time.Since(start)
+	if err != nil {
+		log.Printf("level=error msg=\"Failed to ping the database\" error=%q", err)
+		rndr.JSON(w, http.StatusServiceUnavailable, renderer.M{
+			"db":    "error",
+			"error": pingErrorClass(err),
+		})
+		return
+	}
+
+	rndr.JSON(w, http.StatusOK, renderer.M{
+		"db":        "ok",
+		"latencyMs": float64(latency.Microseconds()) / 1000,
+	})
+}
+
+// pingErrorClass names the kind of a ping failure without its details.
+func pingErrorClass(err error) string {
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return "timeout"
+	}
+	if dbErrorStatus(err) == http.StatusServiceUnavailable {
+		return "unreachable"
+	}
+	return "error"
+}
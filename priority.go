@@ -0,0 +1,14 @@
+package main
+
+// Priorities are stored as ranks so that sorting by priority orders them by
+// importance; clients only ever see the names. The zero rank is a todo
+// without a priority.
+var (
+	priorityRanks = map[string]int{"": 0, "low": 1, "medium": 2, "high": 3}
+	priorityNames = map[int]string{0: "", 1: "low", 2: "medium", 3: "high"}
+)
+
+// priorityValues lists the accepted priority names, for the schema.
+func priorityValues() []string {
+	return []string{"", "low", "medium", "high"}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"time"
+)
+
+// defaultCompletedWithin is the window of GET /todo/recently-completed
+// without ?within=.
+const defaultCompletedWithin = 7 * 24 * time.Hour
+
+// fetchRecentlyCompletedTodo renders the todos completed within ?within=
+// (e.g. "7d" or "12h"), most recently completed first.
+func fetchRecentlyCompletedTodo(w http.ResponseWriter, r *http.Request) {
+	loc, ok := parseTimezone(w, r)
+	if !ok {
+		return
+	}
+
+	within := defaultCompletedWithin
+	if s := r.URL.Query().Get("within"); s != "" {
+		d, err := parseAge(s)
+		if err != nil {
+			rndr.JSON(w, http.StatusBadRequest, renderer.M{
+				"error": "Invalid within " + s,
+			})
+			return
+		}
+		within = d
+	}
+
+	filter := notDeleted()
+	filter["completed"] = true
+	filter["archived"] = bson.M{"$ne": true}
+	filter["completedAt"] = bson.M{"$gte": time.Now().UTC().Add(-within)}
+
+	todos := []todoModel{}
+	if err := timeQuery(r.Context(), "find", filter, func() error {
+		return db.C(collectionName).Find(filter).Sort("-completedAt", "_id").Limit(cfg.maxPageSize).All(&todos)
+	}); err != nil {
+		renderDBError(w, "Failed to fetch todo", err)
+		return
+	}
+
+	renderTodoList(w, todos, loc, nil)
+}
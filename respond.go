@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"github.com/thedevsaddam/renderer"
+	"log"
+	"net/http"
+)
+
+// respondOK writes a success response in the envelope every endpoint
+// shares: the result under "data" and everything about it (messages,
+// warnings, counts, pagination) under "meta", which is left out when nil.
+func respondOK(w http.ResponseWriter, status int, data interface{}, meta renderer.M) {
+	resp := renderer.M{
+		"data": data,
+	}
+	if meta != nil {
+		resp["meta"] = meta
+	}
+	if err := rndr.JSON(w, status, resp); err != nil {
+		renderFailed(err)
+	}
+}
+
+// renderFailed logs a response that couldn't be written, typically because
+// the client went away. There is no way to tell the client anymore, and it
+// mustn't stop the server.
+func renderFailed(err error) {
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+// renderBadBody answers a request body that couldn't be read or decoded.
+// The decoder's error is only logged: it may quote the body back, and
+// nothing below the HTTP layer should reach the client verbatim. A batch
+// cut short for being over MAX_BATCH_SIZE or MAX_BODY_BYTES gets its 413
+// instead.
+func renderBadBody(w http.ResponseWriter, err error) {
+	if errors.Is(err, errBatchTooLarge) {
+		renderBatchTooLarge(w)
+		return
+	}
+	if errors.Is(err, errBodyTooLarge) {
+		renderBodyTooLarge(w)
+		return
+	}
+	log.Printf("level=warn msg=\"invalid request body\" error=%q", err)
+	if err1 := rndr.JSON(w, http.StatusBadRequest, renderer.M{
+		"error": "The request body is not valid JSON",
+	}); err1 != nil {
+		renderFailed(err1)
+	}
+}
+
+// errAlreadyWritten is returned by the writes of a second response.
+var errAlreadyWritten = errors.New("response already written")
+
+// committedWriter remembers whether the response status went out, so a
+// handler that writes a second response only gets it logged instead of
+// mangling the first: its status and its body are both dropped.
+type committedWriter struct {
+	http.ResponseWriter
+	committed bool
+	discard   bool
+	request   string
+}
+
+func (cw *committedWriter) WriteHeader(status int) {
+	if cw.committed {
+		log.Printf("level=warn msg=\"response already written\" request=%q status=%d", cw.request, status)
+		cw.discard = true
+		return
+	}
+	cw.committed = true
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *committedWriter) Write(b []byte) (int, error) {
+	if cw.discard {
+		return 0, errAlreadyWritten
+	}
+	if !cw.committed {
+		cw.committed = true
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// writeOnce makes every handler's response committed once.
+func writeOnce(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&committedWriter{ResponseWriter: w, request: r.Method + " " + r.URL.Path}, r)
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// failingWriter takes n bytes of body and then fails every write, like a
+// client that goes away mid-response.
+type failingWriter struct {
+	*httptest.ResponseRecorder
+	n       int
+	headers int
+}
+
+func (fw *failingWriter) WriteHeader(status int) {
+	fw.headers++
+	fw.ResponseRecorder.WriteHeader(status)
+}
+
+func (fw *failingWriter) Write(b []byte) (int, error) {
+	if fw.n <= 0 {
+		return 0, errors.New("broken pipe")
+	}
+	if len(b) > fw.n {
+		b = b[:fw.n]
+	}
+	fw.n -= len(b)
+	fw.ResponseRecorder.Write(b)
+	return len(b), errors.New("broken pipe")
+}
+
+// doubleResponse answers like the handlers that used to try an error
+// response after a failed write.
+func doubleResponse(w http.ResponseWriter, r *http.Request) {
+	if err := rndr.JSON(w, http.StatusOK, map[string]string{"data": "a long enough first response"}); err != nil {
+		rndr.JSON(w, http.StatusInternalServerError, map[string]string{"error": "second"})
+	}
+}
+
+func TestWriteOnceWithWriterFailingMidWrite(t *testing.T) {
+	fw := &failingWriter{ResponseRecorder: httptest.NewRecorder(), n: 10}
+	writeOnce(http.HandlerFunc(doubleResponse)).ServeHTTP(fw, httptest.NewRequest(http.MethodGet, "/todo", nil))
+
+	if fw.headers != 1 || fw.Code != http.StatusOK {
+		t.Errorf("got %d status writes, status %d, want the 200 once", fw.headers, fw.Code)
+	}
+	if got := fw.Body.String(); got != `{"data":"a` {
+		t.Errorf("body = %q, want only the part of the first response that went through", got)
+	}
+}
+
+func TestWriteOnceDropsSecondResponse(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeOnce(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respondOK(w, http.StatusOK, "first", nil)
+		if err := rndr.JSON(w, http.StatusInternalServerError, map[string]string{"error": "second"}); err != errAlreadyWritten {
+			t.Errorf("second response error = %v, want errAlreadyWritten", err)
+		}
+	})).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todo", nil))
+
+	if w.Code != http.StatusOK || w.Body.String() != `{"data":"first"}` {
+		t.Errorf("got %d %q, want only the first response", w.Code, w.Body)
+	}
+}
+
+func TestWriteOnceKeepsStreams(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeOnce(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		for _, part := range []string{`{"data":[`, `1`, `,2`, `]}`} {
+			w.Write([]byte(part))
+		}
+	})).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todo", nil))
+
+	if w.Body.String() != `{"data":[1,2]}` {
+		t.Errorf("body = %q, want every write of a single response", w.Body)
+	}
+}
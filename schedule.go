@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"time"
+)
+
+// scheduleRequest sets dueDate on ids; a null dueDate clears it. It's kept
+// raw to tell null apart from a missing dueDate.
+type scheduleRequest struct {
+	IDs     batchIDs        `json:"ids"`
+	DueDate json.RawMessage `json:"dueDate"`
+}
+
+func scheduleTodo(w http.ResponseWriter, r *http.Request) {
+	var req scheduleRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		renderBadBody(w, err)
+		return
+	}
+
+	ids, ok := parseIDs(w, req.IDs)
+	if !ok {
+		return
+	}
+	if len(req.DueDate) == 0 {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "Missing dueDate, use null to clear it",
+		})
+		return
+	}
+
+	update := bson.M{"$unset": bson.M{"dueDate": ""}}
+	if string(req.DueDate) != "null" {
+		var due time.Time
+		if err := json.Unmarshal(req.DueDate, &due); err != nil {
+			rndr.JSON(w, http.StatusUnprocessableEntity, renderer.M{
+				"errors": []fieldError{{Field: "dueDate", Pointer: "/dueDate", Message: "The due date must be an RFC 3339 date-time"}},
+			})
+			return
+		}
+		update = bson.M{"$set": bson.M{"dueDate": due.UTC()}}
+	}
+
+	notFound, ok := missingIDs(w, r, ids)
+	if !ok {
+		return
+	}
+
+	var info *mgo.ChangeInfo
+	selector := activeTodos(ids)
+	if err := timeQuery(r.Context(), "updateAll", selector, func() (err error) {
+		info, err = db.C(collectionName).UpdateAll(selector, update)
+		return err
+	}); err != nil {
+		renderDBError(w, "Failed to schedule TODOs", err)
+		return
+	}
+
+	respondOK(w, http.StatusOK, renderer.M{
+		"modified": info.Updated,
+		"notFound": notFound,
+	}, renderer.M{
+		"message": "TODOs scheduled successfully.",
+	})
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/thedevsaddam/renderer"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// todoSchema is the JSON Schema of the create/update payload. It's built
+// from the same limits validateTodo uses so the two can't drift apart.
+// Unknown properties are allowed since clients echo back response fields.
+var (
+	todoSchemaDoc map[string]interface{}
+	todoSchema    *jsonschema.Schema
+)
+
+// todoPatchSchema is the JSON Schema of a PATCH payload: any subset of the
+// editable fields, and nothing else.
+var (
+	todoPatchSchemaDoc map[string]interface{}
+	todoPatchSchema    *jsonschema.Schema
+)
+
+// compileSchemas builds the payload schemas. Some limits are configurable,
+// so it runs once the config is loaded.
+func compileSchemas() {
+	todoSchemaDoc = map[string]interface{}{
+		"$schema":    "https://json-schema.org/draft/2020-12/schema",
+		"type":       "object",
+		"required":   []string{"title"},
+		"properties": todoProperties(),
+	}
+	todoSchema = mustCompileSchema("todo.json", todoSchemaDoc)
+
+	todoPatchSchemaDoc = map[string]interface{}{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"type":                 "object",
+		"minProperties":        1,
+		"properties":           todoPatchProperties(),
+		"additionalProperties": false,
+	}
+	todoPatchSchema = mustCompileSchema("todo-patch.json", todoPatchSchemaDoc)
+}
+
+// todoProperties are the schemas of the create/update payload fields.
+func todoProperties() map[string]interface{} {
+	return map[string]interface{}{
+		"id":          map[string]interface{}{"type": "string", "pattern": "^([0-9a-fA-F]{24})?$"},
+		"title":       map[string]interface{}{"type": "string", "minLength": 1, "maxLength": maxTitleLength},
+		"externalId":  map[string]interface{}{"type": "string", "maxLength": maxExternalIDLength},
+		"description": map[string]interface{}{"type": "string", "maxLength": maxDescriptionLength},
+		"completed":   map[string]interface{}{"type": "boolean"},
+		"assignee":    map[string]interface{}{"type": "string", "maxLength": maxAssigneeLength},
+		"tags": map[string]interface{}{
+			"type":     "array",
+			"maxItems": cfg.maxTags,
+			"items":    map[string]interface{}{"type": "string", "maxLength": maxTagLength},
+		},
+		"estimateMinutes": map[string]interface{}{"type": "integer", "minimum": 0},
+		"sortKey":         map[string]interface{}{"type": "string", "maxLength": maxSortKeyLength},
+		"priority":        map[string]interface{}{"enum": priorityValues()},
+		"metadata": map[string]interface{}{
+			"type":                 "object",
+			"maxProperties":        cfg.maxMetadataEntries,
+			"propertyNames":        map[string]interface{}{"maxLength": maxMetadataKeyLength, "pattern": metadataKeyPattern.String()},
+			"additionalProperties": map[string]interface{}{"type": "string", "maxLength": maxMetadataValueLength},
+		},
+		"dueDate":   map[string]interface{}{"type": []string{"string", "null"}, "format": "date-time"},
+		"createdAt": map[string]interface{}{"type": "string", "format": "date-time"},
+	}
+}
+
+// todoPatchProperties are the fields a PATCH may change. Unlike PUT it can
+// also correct completedAt, or clear it with null.
+func todoPatchProperties() map[string]interface{} {
+	props := todoProperties()
+	delete(props, "id")
+	delete(props, "externalId")
+	delete(props, "createdAt")
+	props["completedAt"] = map[string]interface{}{"type": []string{"string", "null"}, "format": "date-time"}
+	return props
+}
+
+// fetchTodoSchema renders the schemas the create/update and PATCH payloads
+// are validated against, with the few rules that live outside them, so a
+// client can build its forms from the server's own rules.
+func fetchTodoSchema(w http.ResponseWriter, r *http.Request) {
+	respondOK(w, http.StatusOK, renderer.M{
+		"todo":       todoSchemaDoc,
+		"patch":      todoPatchSchemaDoc,
+		"priorities": priorityValues(),
+		"limits": renderer.M{
+			"maxBatchSize":          cfg.maxBatchSize,
+			"maxPinned":             cfg.maxPinned,
+			"maxCommentLength":      maxCommentLength,
+			"maxAuthorLength":       maxAuthorLength,
+			"maxAttachmentsPerTodo": cfg.maxAttachments,
+		},
+	}, nil)
+}
+
+func mustCompileSchema(name string, schema map[string]interface{}) *jsonschema.Schema {
+	raw, err := json.Marshal(schema)
+	checkerr(err)
+
+	c := jsonschema.NewCompiler()
+	c.AssertFormat = true
+	checkerr(c.AddResource(name, bytes.NewReader(raw)))
+	return c.MustCompile(name)
+}
+
+// decodeTodo validates the request body against todoSchema and decodes it
+// into t. When the body isn't valid it writes the error response and
+// returns false.
+func decodeTodo(w http.ResponseWriter, r *http.Request, t *todo) bool {
+	body, ok := readValidBody(w, r, todoSchema)
+	if !ok {
+		return false
+	}
+
+	if err := json.Unmarshal(body, t); err != nil {
+		rndr.JSON(w, http.StatusUnprocessableEntity, renderer.M{
+			"errors": []fieldError{decodeFieldError(err)},
+		})
+		return false
+	}
+	return true
+}
+
+// decodeFieldError is the fieldError of a schema-valid body that still
+// doesn't decode into a todo, such as an estimate too large for an int.
+// The decoder's error is only logged, since it names Go types and quotes
+// the value; the client gets a fixed message about the field.
+func decodeFieldError(err error) fieldError {
+	log.Printf("level=warn msg=\"undecodable field\" error=%q", err)
+	var te *json.UnmarshalTypeError
+	if errors.As(err, &te) && te.Field != "" {
+		e := fieldError{
+			Field:   strings.SplitN(te.Field, ".", 2)[0],
+			Pointer: "/" + strings.Replace(te.Field, ".", "/", -1),
+			Message: "The value has the wrong type",
+		}
+		switch te.Type.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			e.Message = "The value must be an integer in range"
+		}
+		return e
+	}
+	var pe *time.ParseError
+	if errors.As(err, &pe) {
+		return fieldError{Message: "A date must be in RFC 3339 format"}
+	}
+	return fieldError{Message: "A value could not be decoded"}
+}
+
+// readValidBody reads the request body and validates it against schema.
+// When the body isn't valid it writes the error response and returns false.
+func readValidBody(w http.ResponseWriter, r *http.Request, schema *jsonschema.Schema) ([]byte, bool) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		renderBadBody(w, err)
+		return nil, false
+	}
+
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	var doc interface{}
+	if err := d.Decode(&doc); err != nil {
+		renderBadBody(w, err)
+		return nil, false
+	}
+	if coerceLenient(doc) {
+		// Re-encoding a document that just decoded can't fail.
+		body, _ = json.Marshal(doc)
+	}
+
+	if errs := schemaErrors(schema, doc); len(errs) > 0 {
+		rndr.JSON(w, http.StatusUnprocessableEntity, renderer.M{
+			"errors": errs,
+		})
+		return nil, false
+	}
+	return body, true
+}
+
+// schemaErrors validates doc and flattens the schema errors to one
+// fieldError per failing value.
+func schemaErrors(s *jsonschema.Schema, doc interface{}) []fieldError {
+	err := s.Validate(doc)
+	if err == nil {
+		return nil
+	}
+	ve, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		log.Printf("level=error msg=\"schema validation failed\" error=%q", err)
+		return []fieldError{{Message: "The body could not be validated"}}
+	}
+
+	errs := []fieldError{}
+	var walk func(*jsonschema.ValidationError)
+	walk = func(ve *jsonschema.ValidationError) {
+		if len(ve.Causes) == 0 {
+			field := strings.SplitN(strings.TrimPrefix(ve.InstanceLocation, "/"), "/", 2)[0]
+			errs = append(errs, fieldError{Field: field, Pointer: ve.InstanceLocation, Message: ve.Message})
+			return
+		}
+		for _, c := range ve.Causes {
+			walk(c)
+		}
+	}
+	walk(ve)
+	return errs
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxFuzzyCandidates bounds how many todos a fuzzy search scores. Fuzzy
+	// matching can't use an index, so every candidate is loaded and compared
+	// in Go; the cap keeps that cost fixed at the price of possibly missing
+	// matches in very large collections.
+	maxFuzzyCandidates int = 500
+	// maxRegexCandidates bounds how many todos a ?q= search ranks. The
+	// matches are scored in Go, so past the cap some may be missed.
+	maxRegexCandidates int = 500
+)
+
+type fuzzyMatch struct {
+	todo     todoModel
+	distance int
+}
+
+// fuzzySearchTodos renders the todos matching filter whose title is within a
+// small edit distance of q, closest first.
+func fuzzySearchTodos(w http.ResponseWriter, r *http.Request, filter bson.M, q string, loc *time.Location) {
+	candidates := []todoModel{}
+
+	if err := timeQuery(r.Context(), "find", filter, func() error {
+		return db.C(collectionName).Find(filter).Limit(maxFuzzyCandidates).All(&candidates)
+	}); err != nil {
+		renderDBError(w, "Failed to fetch todo", err)
+		return
+	}
+
+	q = strings.ToLower(q)
+	threshold := fuzzyThreshold(q)
+
+	matches := []fuzzyMatch{}
+	for _, c := range candidates {
+		if d := titleDistance(q, strings.ToLower(c.Title)); d <= threshold {
+			matches = append(matches, fuzzyMatch{todo: c, distance: d})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].distance < matches[j].distance
+	})
+
+	todos := []todoModel{}
+	for _, m := range matches {
+		todos = append(todos, m.todo)
+	}
+	renderTodoList(w, todos, loc, nil)
+}
+
+// regexSearchTodos renders the todos matching filter whose title contains
+// q, ranked by matchScore and then oldest first, with ties broken on _id
+// so that the order doesn't change from one search to the next.
+func regexSearchTodos(w http.ResponseWriter, r *http.Request, filter bson.M, q string, loc *time.Location) {
+	filter["title"] = bson.M{"$regex": regexp.QuoteMeta(q), "$options": "i"}
+	todos := []todoModel{}
+
+	if err := timeQuery(r.Context(), "find", filter, func() error {
+		return db.C(collectionName).Find(filter).Sort("createdAt", "_id").Limit(maxRegexCandidates).All(&todos)
+	}); err != nil {
+		renderDBError(w, "Failed to fetch todo", err)
+		return
+	}
+
+	q = strings.ToLower(q)
+	scores := map[bson.ObjectId]int{}
+	for _, t := range todos {
+		scores[t.ID] = matchScore(q, strings.ToLower(t.Title))
+	}
+	sort.SliceStable(todos, func(i, j int) bool {
+		if si, sj := scores[todos[i].ID], scores[todos[j].ID]; si != sj {
+			return si > sj
+		}
+		if !todos[i].CreatedAt.Equal(todos[j].CreatedAt) {
+			return todos[i].CreatedAt.Before(todos[j].CreatedAt)
+		}
+		return todos[i].ID < todos[j].ID
+	})
+
+	renderTodoList(w, todos, loc, nil)
+}
+
+// matchScore ranks where q occurs in title, both lower-cased: 3 when the
+// title starts with it, 2 when a word does, 1 anywhere else and 0 not at all.
+func matchScore(q, title string) int {
+	if strings.HasPrefix(title, q) {
+		return 3
+	}
+	score := 0
+	for i := 0; ; {
+		j := strings.Index(title[i:], q)
+		if j < 0 {
+			return score
+		}
+		i += j
+		prev, _ := utf8.DecodeLastRuneInString(title[:i])
+		if !unicode.IsLetter(prev) && !unicode.IsDigit(prev) {
+			return 2
+		}
+		score = 1
+		i += len(q)
+	}
+}
+
+// textSearchTodos renders the todos matching filter and the $text query,
+// most relevant first, with each todo's text score included.
+func textSearchTodos(w http.ResponseWriter, r *http.Request, filter bson.M, search string, loc *time.Location) {
+	filter["$text"] = bson.M{"$search": search}
+	todos := []todoModel{}
+
+	if err := timeQuery(r.Context(), "find", filter, func() error {
+		return db.C(collectionName).Find(filter).
+			Select(bson.M{"score": bson.M{"$meta": "textScore"}}).
+			Sort("$textScore:score", "_id").
+			All(&todos)
+	}); err != nil {
+		renderDBError(w, "Failed to fetch todo", err)
+		return
+	}
+
+	renderTodoList(w, todos, loc, nil)
+}
+
+// fuzzyThreshold is the largest edit distance still counted as a match;
+// short queries get less slack so that they don't match everything.
+func fuzzyThreshold(q string) int {
+	switch n := len([]rune(q)); {
+	case n <= 3:
+		return 0
+	case n <= 6:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// titleDistance is the smallest edit distance between q and either the whole
+// title or any single word of it, so a query can match part of a title.
+func titleDistance(q, title string) int {
+	best := levenshtein(q, title)
+	for _, word := range strings.Fields(title) {
+		if d := levenshtein(q, word); d < best {
+			best = d
+		}
+	}
+	return best
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
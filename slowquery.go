@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"gopkg.in/mgo.v2/bson"
+	"log"
+	"time"
+)
+
+// timeQuery runs the DB operation fn and logs a warning when it takes longer
+// than cfg.slowQuery. Only the shape of filter is logged, never its values,
+// so that slow-query logs can't leak todo contents. The time also counts
+// towards the db entry of the request's Server-Timing.
+func timeQuery(ctx context.Context, op string, filter interface{}, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	elapsed := time.Since(start)
+	addDBTime(ctx, elapsed)
+	if cfg.slowQuery > 0 && elapsed > cfg.slowQuery {
+		shape, _ := json.Marshal(filterShape(filter))
+		log.Printf("level=warn msg=\"slow query\" op=%s duration_ms=%d filter=%s", op, elapsed.Milliseconds(), shape)
+	}
+	return err
+}
+
+// filterShape replaces every value in a filter with "?" while keeping field
+// names and operators, e.g. {"title":{"$regex":"?"}}.
+func filterShape(v interface{}) interface{} {
+	switch f := v.(type) {
+	case nil:
+		return nil
+	case bson.M:
+		shape := map[string]interface{}{}
+		for k, val := range f {
+			shape[k] = filterShape(val)
+		}
+		return shape
+	case map[string]interface{}:
+		return filterShape(bson.M(f))
+	case []bson.M:
+		shape := []interface{}{}
+		for _, val := range f {
+			shape = append(shape, filterShape(val))
+		}
+		return shape
+	case []interface{}:
+		shape := []interface{}{}
+		for _, val := range f {
+			shape = append(shape, filterShape(val))
+		}
+		return shape
+	default:
+		return "?"
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// snapshotInterval is how often the snapshot job refreshes the snapshot
+	// of the day, so that it ends up close to the day's final counts.
+	snapshotInterval = time.Hour
+
+	defaultTrendDays int = 30
+	maxTrendDays     int = 366
+)
+
+// snapshot is the count of live todos on a UTC day. It keeps the history
+// that can't be rebuilt from the todos later, such as how many were open on
+// a given day, since todos get deleted and uncompleted.
+type snapshot struct {
+	Date      string    `json:"date" bson:"_id"`
+	Total     int       `json:"total" bson:"total"`
+	Completed int       `json:"completed" bson:"completed"`
+	Pending   int       `json:"pending" bson:"pending"`
+	TakenAt   time.Time `json:"takenAt" bson:"takenAt"`
+}
+
+// takeSnapshot counts the todos outside the trash and stores the counts as
+// the snapshot of the current day, replacing an earlier one of that day.
+func takeSnapshot(ctx context.Context) (snapshot, error) {
+	now := time.Now().UTC()
+	s := snapshot{Date: now.Format("2006-01-02"), TakenAt: now}
+
+	filter := notDeleted()
+	pipeline := []bson.M{
+		{"$match": filter},
+		{"$group": bson.M{
+			"_id":       nil,
+			"total":     bson.M{"$sum": 1},
+			"completed": bson.M{"$sum": bson.M{"$cond": []interface{}{"$completed", 1, 0}}},
+		}},
+	}
+	var counts todoStats
+	if err := timeQuery(ctx, "aggregate", pipeline, func() error {
+		return db.C(collectionName).Pipe(pipeline).One(&counts)
+	}); err != nil && err != mgo.ErrNotFound {
+		return s, err
+	}
+	s.Total = counts.Total
+	s.Completed = counts.Completed
+	s.Pending = counts.Total - counts.Completed
+
+	err := timeQuery(ctx, "upsert", nil, func() error {
+		_, err := db.C(snapshotsName).UpsertId(s.Date, s)
+		return err
+	})
+	return s, err
+}
+
+// snapshotJob takes a snapshot at startup and then every snapshotInterval
+// until ctx is done.
+func snapshotJob(ctx context.Context) {
+	ticker := time.NewTicker(snapshotInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := takeSnapshot(ctx); err != nil {
+			log.Printf("level=error msg=\"failed to take snapshot\" err=%q", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// createSnapshot takes the snapshot of the day right away, e.g. before a
+// bulk cleanup that would otherwise only show up in the next one.
+func createSnapshot(w http.ResponseWriter, r *http.Request) {
+	s, err := takeSnapshot(r.Context())
+	if err != nil {
+		renderDBError(w, "Failed to take snapshot", err)
+		return
+	}
+
+	respondOK(w, http.StatusOK, s, renderer.M{
+		"message": "Snapshot taken successfully.",
+	})
+}
+
+// fetchTodoTrend returns the daily snapshots of the last ?days= days, oldest
+// first. Days the server didn't run on have no snapshot and are left out.
+func fetchTodoTrend(w http.ResponseWriter, r *http.Request) {
+	days := defaultTrendDays
+	if s := r.URL.Query().Get("days"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxTrendDays {
+			rndr.JSON(w, http.StatusBadRequest, renderer.M{
+				"error": "Invalid days " + s + ", expected 1 to " + strconv.Itoa(maxTrendDays),
+			})
+			return
+		}
+		days = n
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, 1-days).Format("2006-01-02")
+	filter := bson.M{"_id": bson.M{"$gte": since}}
+	series := []snapshot{}
+	if err := timeQuery(r.Context(), "find", filter, func() error {
+		return db.C(snapshotsName).Find(filter).Sort("_id").All(&series)
+	}); err != nil {
+		renderDBError(w, "Failed to fetch TODO trend", err)
+		return
+	}
+
+	respondOK(w, http.StatusOK, series, renderer.M{
+		"days":  days,
+		"since": since,
+	})
+}
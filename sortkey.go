@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"github.com/thedevsaddam/renderer"
+	"net/http"
+	"strings"
+)
+
+// Sort keys are fractional indexes: strings over sortKeyDigits compared
+// byte by byte, read as the digits of a fraction. There is always a key
+// between two others, so a todo can be dropped anywhere by giving it a new
+// key without renumbering the rest. A key never ends in the lowest digit,
+// which keeps room below every key.
+
+// sortKeyDigits are the digits of a sort key, in ASCII order.
+const sortKeyDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// validateSortKey returns why a sort key is invalid, or "" when it's fine.
+// The empty key means no key.
+func validateSortKey(key string) string {
+	if len(key) > maxSortKeyLength {
+		return "The sort key is too long"
+	}
+	for _, c := range key {
+		if !strings.ContainsRune(sortKeyDigits, c) {
+			return "The sort key may only contain digits and ASCII letters"
+		}
+	}
+	if strings.HasSuffix(key, sortKeyDigits[:1]) {
+		return "The sort key cannot end in " + sortKeyDigits[:1]
+	}
+	return ""
+}
+
+// sortKeyBetween returns a key sorting after a and before b, where "" for a
+// is the start of the list and "" for b its end.
+func sortKeyBetween(a, b string) (string, error) {
+	if err := validateSortKey(a); err != "" {
+		return "", errors.New(err)
+	}
+	if err := validateSortKey(b); err != "" {
+		return "", errors.New(err)
+	}
+	if b != "" && a >= b {
+		return "", errors.New("The after key must sort before the before key")
+	}
+	return sortKeyMidpoint(a, b), nil
+}
+
+// sortKeyMidpoint is sortKeyBetween without the checks.
+func sortKeyMidpoint(a, b string) string {
+	if b != "" {
+		// Skip the common prefix, reading a as padded with the lowest digit.
+		n := 0
+		for n < len(b) && digitAt(a, n) == b[n] {
+			n++
+		}
+		if n > 0 {
+			rest := ""
+			if n < len(a) {
+				rest = a[n:]
+			}
+			return b[:n] + sortKeyMidpoint(rest, b[n:])
+		}
+	}
+
+	digitA := 0
+	if a != "" {
+		digitA = strings.IndexByte(sortKeyDigits, a[0])
+	}
+	digitB := len(sortKeyDigits)
+	if b != "" {
+		digitB = strings.IndexByte(sortKeyDigits, b[0])
+	}
+	if digitB-digitA > 1 {
+		return sortKeyDigits[(digitA+digitB+1)/2 : (digitA+digitB+1)/2+1]
+	}
+	// The first digits are adjacent: the first digit of a longer b already
+	// sorts between the two, otherwise extend a.
+	if len(b) > 1 {
+		return b[:1]
+	}
+	rest := ""
+	if len(a) > 1 {
+		rest = a[1:]
+	}
+	return sortKeyDigits[digitA:digitA+1] + sortKeyMidpoint(rest, "")
+}
+
+// digitAt is the i-th digit of key, or the lowest digit past its end.
+func digitAt(key string, i int) byte {
+	if i < len(key) {
+		return key[i]
+	}
+	return sortKeyDigits[0]
+}
+
+// fetchSortKey answers with a sort key between ?after= and ?before=, either
+// of which may be left out for the start or end of the list.
+func fetchSortKey(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	key, err := sortKeyBetween(query.Get("after"), query.Get("before"))
+	if err != nil {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	respondOK(w, http.StatusOK, renderer.M{
+		"sortKey": key,
+	}, nil)
+}
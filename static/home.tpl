@@ -115,11 +115,18 @@
           todos: []
         },
         mounted () {
-          this.$http.get('todo').then(response => {
-            this.todos = response.body.data;
-          });
+          this.loadTodos(0);
         },
         methods: {
+          loadTodos(offset){
+            this.$http.get('todo', {params: {offset: offset}}).then(response => {
+              this.todos = this.todos.concat(response.body.data);
+              var meta = response.body.meta;
+              if (meta.hasMore) {
+                this.loadTodos(meta.offset + meta.limit);
+              }
+            });
+          },
           addTodo(){
             if (this.todo.title == ''){
               this.showError = true;
@@ -136,7 +143,7 @@
               }else{
                 this.$http.post('todo', {title: this.todo.title}).then(response => {
                   if(response.status == 201){
-                    this.todos.push({id: response.body.todo_id, title: this.todo.title, completed: false});
+                    this.todos.push(response.body.data);
                     this.todo = {id: '', title: '', completed: false};
                   }
                 });
@@ -0,0 +1,58 @@
+<!doctype html>
+<html lang="en">
+  <head>
+    <title>Todo</title>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1, shrink-to-fit=no">
+    <link rel="stylesheet" href="https://maxcdn.bootstrapcdn.com/bootstrap/4.0.0-beta.2/css/bootstrap.min.css" integrity="sha384-PsH8R72JQ3SOdhVi3uxftmaW6Vc51MKb0q5P2rRUpPvrszuE4W1povHYgTpBfshb" crossorigin="anonymous">
+    <style type="text/css">
+      .del {
+          text-decoration: line-through;
+      }
+      .todo-title{
+        width: 100%;
+        background: #b88f92;
+        color: #FFF;
+        font-size: 30px;
+        font-weight: bold;
+        padding: 20px 10px;
+        text-align: center;
+        border-top-left-radius: 5px;
+        border-top-right-radius: 5px;
+      }
+    </style>
+  </head>
+  <body>
+    <div class="container">
+        <div class="row">
+            <div class="col-6 offset-3">
+                <br><br>
+                <div class="todo-title">
+                  Daily Todo Lists
+                </div>
+                {{if .Error}}
+                <div class="alert alert-danger">{{.Error}}</div>
+                {{end}}
+                <form method="post" action="">
+                  <input type="hidden" name="{{.CSRFField}}" value="{{.CSRFToken}}">
+                  <div class="input-group">
+                    <input type="text" name="title" class="form-control" placeholder="Add your todo" maxlength="{{.MaxTitleLength}}" required>
+                    <span class="input-group-btn">
+                      <button class="btn btn-success" type="submit">Add</button>
+                    </span>
+                  </div>
+                </form>
+                <ul class="list-group">
+                  {{range .Todos}}
+                  <li class="list-group-item">
+                    <span {{if .Completed}}class="del"{{end}}>{{.Title}}</span>
+                  </li>
+                  {{else}}
+                  <li class="list-group-item text-muted">Nothing to do yet.</li>
+                  {{end}}
+                </ul>
+            </div>
+        </div>
+    </div>
+  </body>
+</html>
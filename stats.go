@@ -0,0 +1,169 @@
+package main
+
+import (
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"sort"
+	"time"
+)
+
+type todoStats struct {
+	Total                    int `json:"total" bson:"total"`
+	Completed                int `json:"completed" bson:"completed"`
+	Pending                  int `json:"pending" bson:"-"`
+	TotalEstimateMinutes     int `json:"totalEstimateMinutes" bson:"totalEstimateMinutes"`
+	RemainingEstimateMinutes int `json:"remainingEstimateMinutes" bson:"remainingEstimateMinutes"`
+}
+
+// fetchTodoStats summarizes the todos matching the usual list filters,
+// including how much estimated effort is still pending.
+func fetchTodoStats(w http.ResponseWriter, r *http.Request) {
+	filter, err := todoFilter(r)
+	if err != nil {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	pipeline := []bson.M{
+		{"$match": filter},
+		{"$group": bson.M{
+			"_id":                  nil,
+			"total":                bson.M{"$sum": 1},
+			"completed":            bson.M{"$sum": bson.M{"$cond": []interface{}{"$completed", 1, 0}}},
+			"totalEstimateMinutes": bson.M{"$sum": "$estimateMinutes"},
+			"remainingEstimateMinutes": bson.M{"$sum": bson.M{
+				"$cond": []interface{}{"$completed", 0, "$estimateMinutes"},
+			}},
+		}},
+	}
+
+	var stats todoStats
+	if err := timeQuery(r.Context(), "aggregate", pipeline, func() error {
+		return db.C(collectionName).Pipe(pipeline).One(&stats)
+	}); err != nil && err != mgo.ErrNotFound {
+		renderDBError(w, "Failed to fetch TODO stats", err)
+		return
+	}
+	stats.Pending = stats.Total - stats.Completed
+
+	respondOK(w, http.StatusOK, stats, nil)
+}
+
+// timelineFormats are the $dateToString formats of the timeline buckets;
+// weeks are ISO weeks such as "2024-W01".
+var timelineFormats = map[string]string{
+	"day":   "%Y-%m-%d",
+	"week":  "%G-W%V",
+	"month": "%Y-%m",
+}
+
+// defaultTimelineSince is how far back the timeline goes without ?since=.
+const defaultTimelineSince = 30 * 24 * time.Hour
+
+type timelinePoint struct {
+	Date      string `json:"date"`
+	Created   int    `json:"created"`
+	Completed int    `json:"completed"`
+}
+
+type timelineCount struct {
+	Date  string `bson:"_id"`
+	Count int    `bson:"count"`
+}
+
+// fetchTodoTimeline counts the todos created and completed in each ?bucket=
+// (day, week or month) since ?since=, bucketed in the ?tz= timezone.
+func fetchTodoTimeline(w http.ResponseWriter, r *http.Request) {
+	loc, ok := parseTimezone(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	bucket := query.Get("bucket")
+	if bucket == "" {
+		bucket = "day"
+	}
+	format, ok := timelineFormats[bucket]
+	if !ok {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "Invalid bucket " + bucket + ", expected day, week or month",
+		})
+		return
+	}
+
+	since := time.Now().Add(-defaultTimelineSince)
+	if s := query.Get("since"); s != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, s); err != nil {
+			if since, err = time.ParseInLocation("2006-01-02", s, loc); err != nil {
+				rndr.JSON(w, http.StatusBadRequest, renderer.M{
+					"error": "Invalid since " + s + ", expected a date or an RFC 3339 date-time",
+				})
+				return
+			}
+		}
+	}
+
+	filter, err := todoFilter(r)
+	if err != nil {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	points := map[string]*timelinePoint{}
+	point := func(date string) *timelinePoint {
+		if points[date] == nil {
+			points[date] = &timelinePoint{Date: date}
+		}
+		return points[date]
+	}
+	for _, field := range []string{"createdAt", "completedAt"} {
+		match := bson.M{field: bson.M{"$gte": since.UTC()}}
+		for k, v := range filter {
+			match[k] = v
+		}
+		pipeline := []bson.M{
+			{"$match": match},
+			{"$group": bson.M{
+				"_id":   bson.M{"$dateToString": bson.M{"format": format, "date": "$" + field, "timezone": loc.String()}},
+				"count": bson.M{"$sum": 1},
+			}},
+		}
+
+		counts := []timelineCount{}
+		if err := timeQuery(r.Context(), "aggregate", pipeline, func() error {
+			return db.C(collectionName).Pipe(pipeline).All(&counts)
+		}); err != nil {
+			renderDBError(w, "Failed to fetch TODO stats", err)
+			return
+		}
+		for _, c := range counts {
+			if field == "createdAt" {
+				point(c.Date).Created = c.Count
+			} else {
+				point(c.Date).Completed = c.Count
+			}
+		}
+	}
+
+	// The bucket labels sort chronologically as strings.
+	series := []timelinePoint{}
+	for _, p := range points {
+		series = append(series, *p)
+	}
+	sort.Slice(series, func(i, j int) bool {
+		return series[i].Date < series[j].Date
+	})
+
+	respondOK(w, http.StatusOK, series, renderer.M{
+		"bucket": bucket,
+		"since":  since.In(loc),
+	})
+}
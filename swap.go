@@ -0,0 +1,115 @@
+package main
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"strings"
+)
+
+func moveUpTodo(w http.ResponseWriter, r *http.Request) {
+	swapWithNeighbour(w, r, true)
+}
+
+func moveDownTodo(w http.ResponseWriter, r *http.Request) {
+	swapWithNeighbour(w, r, false)
+}
+
+// swapWithNeighbour swaps the position of a todo with the one right above
+// (up) or below it in the default list. Lists keep pinned todos first, so
+// the neighbour is looked for in the todo's own group, pinned or not, and
+// a todo never trades places with one it isn't next to on screen. Mongo
+// can't update two documents atomically, so each write only applies while
+// the position it read still holds, and the first is undone when the second
+// loses a race.
+func swapWithNeighbour(w http.ResponseWriter, r *http.Request, up bool) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+
+	if !bson.IsObjectIdHex(id) {
+		if err1 := rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "Invalid URL request",
+		}); err1 != nil {
+			renderFailed(err1)
+			return
+		}
+		return
+	}
+
+	c := db.C(collectionName)
+
+	var tm todoModel
+	selector := activeTodo(bson.ObjectIdHex(id))
+	if err := timeQuery(r.Context(), "findOne", selector, func() error {
+		return c.Find(selector).One(&tm)
+	}); err != nil {
+		if err == mgo.ErrNotFound {
+			renderMissingTodo(w, r, bson.ObjectIdHex(id))
+			return
+		}
+		renderDBError(w, "Failed to move TODO", err)
+		return
+	}
+
+	filter := notDeleted()
+	filter["archived"] = bson.M{"$ne": true}
+	if tm.Pinned {
+		filter["pinned"] = true
+	} else {
+		filter["pinned"] = bson.M{"$ne": true}
+	}
+	sortBy := "position"
+	if up {
+		filter["position"] = bson.M{"$lt": tm.Position}
+		sortBy = "-position"
+	} else {
+		filter["position"] = bson.M{"$gt": tm.Position}
+	}
+
+	var neighbour todoModel
+	if err := timeQuery(r.Context(), "findOne", filter, func() error {
+		return c.Find(filter).Sort(sortBy).One(&neighbour)
+	}); err != nil {
+		// Already at the top or bottom: nothing to do.
+		if err == mgo.ErrNotFound {
+			respondOK(w, http.StatusOK, []todoPosition{{ID: tm.ID.Hex(), Position: tm.Position}}, renderer.M{
+				"message": "TODO is already at the edge of its group.",
+			})
+			return
+		}
+		renderDBError(w, "Failed to move TODO", err)
+		return
+	}
+
+	setPosition := func(id bson.ObjectId, from, to int) error {
+		selector := bson.M{"_id": id, "position": from}
+		return timeQuery(r.Context(), "update", selector, func() error {
+			return c.Update(selector, bson.M{"$set": bson.M{"position": to}})
+		})
+	}
+	err := setPosition(tm.ID, tm.Position, neighbour.Position)
+	if err == nil {
+		err = setPosition(neighbour.ID, neighbour.Position, tm.Position)
+		if err != nil {
+			setPosition(tm.ID, neighbour.Position, tm.Position)
+		}
+	}
+	if err == mgo.ErrNotFound {
+		rndr.JSON(w, http.StatusConflict, renderer.M{
+			"error": "The TODOs moved in the meantime, please retry",
+		})
+		return
+	}
+	if err != nil {
+		renderDBError(w, "Failed to move TODO", err)
+		return
+	}
+
+	respondOK(w, http.StatusOK, []todoPosition{
+		{ID: tm.ID.Hex(), Position: neighbour.Position},
+		{ID: neighbour.ID.Hex(), Position: tm.Position},
+	}, renderer.M{
+		"message": "TODO moved successfully.",
+	})
+}
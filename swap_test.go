@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+// The list shows pinned todos first, so moving a todo only swaps it with a
+// neighbour from its own group.
+func TestSwapStaysWithinPinnedGroup(t *testing.T) {
+	testDB(t)
+	h := todoHandler()
+	top := insertTodo(t, todoModel{Title: "unpinned top", Position: 0})
+	pinned := insertTodo(t, todoModel{Title: "pinned", Position: 1, Pinned: true})
+	bottom := insertTodo(t, todoModel{Title: "unpinned bottom", Position: 2})
+
+	// Shown as: pinned, unpinned top, unpinned bottom.
+	if w := serve(h, http.MethodPost, "/"+pinned.Hex()+"/move-up", ""); w.Code != http.StatusOK {
+		t.Fatalf("up = %d %s, want 200", w.Code, w.Body)
+	}
+	if w := serve(h, http.MethodPost, "/"+pinned.Hex()+"/move-down", ""); w.Code != http.StatusOK {
+		t.Fatalf("down = %d %s, want 200", w.Code, w.Body)
+	}
+	if p := storedTodo(t, pinned).Position; p != 1 {
+		t.Errorf("the only pinned todo moved to %d, want it left at 1", p)
+	}
+
+	if w := serve(h, http.MethodPost, "/"+bottom.Hex()+"/move-up", ""); w.Code != http.StatusOK {
+		t.Fatalf("up = %d %s, want 200", w.Code, w.Body)
+	}
+	if p := storedTodo(t, bottom).Position; p != 0 {
+		t.Errorf("moved todo at %d, want 0 from its unpinned neighbour", p)
+	}
+	if p := storedTodo(t, top).Position; p != 2 {
+		t.Errorf("unpinned neighbour at %d, want 2", p)
+	}
+	if p := storedTodo(t, pinned).Position; p != 1 {
+		t.Errorf("pinned todo moved to %d, want it left out of the swap", p)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"strings"
+)
+
+type bulkTagRequest struct {
+	IDs    batchIDs `json:"ids"`
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+}
+
+// normalizeTag lower-cases a tag and collapses its whitespace so that "Work ",
+// "work" and "WORK" are the same tag.
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.Join(strings.Fields(tag), " "))
+}
+
+// normalizeTags normalizes every tag, dropping empty ones and duplicates.
+func normalizeTags(tags []string) []string {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// tagsOrEmpty keeps todos stored before tags existed rendering as [] not null.
+func tagsOrEmpty(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
+
+func bulkTagTodo(w http.ResponseWriter, r *http.Request) {
+	var req bulkTagRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		renderBadBody(w, err)
+		return
+	}
+
+	ids, ok := parseIDs(w, req.IDs)
+	if !ok {
+		return
+	}
+
+	add, remove := normalizeTags(req.Add), normalizeTags(req.Remove)
+	if len(add) == 0 && len(remove) == 0 {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "No tags to add or remove",
+		})
+		return
+	}
+	errs := []fieldError{}
+	for _, tag := range append(append([]string{}, add...), remove...) {
+		if err := validateTag(tag); err != "" {
+			errs = append(errs, fieldError{Field: "tags", Message: err})
+		}
+	}
+	if len(errs) > 0 {
+		rndr.JSON(w, http.StatusUnprocessableEntity, renderer.M{
+			"errors": errs,
+		})
+		return
+	}
+
+	c := db.C(collectionName)
+	selector := activeTodos(ids)
+	added, removed := 0, 0
+
+	// $addToSet can't be capped in the same write, so the tag counts are
+	// checked up front; a concurrent add can still slip past the cap.
+	if len(add) > 0 {
+		var current []struct {
+			ID   bson.ObjectId `bson:"_id"`
+			Tags []string      `bson:"tags"`
+		}
+		if err := timeQuery(r.Context(), "find", selector, func() error {
+			return c.Find(selector).Select(bson.M{"tags": 1}).All(&current)
+		}); err != nil {
+			renderDBError(w, "Failed to add tags", err)
+			return
+		}
+		removing := map[string]bool{}
+		for _, tag := range remove {
+			removing[tag] = true
+		}
+		over := []string{}
+		for _, t := range current {
+			n := 0
+			for _, tag := range normalizeTags(append(append([]string{}, t.Tags...), add...)) {
+				if !removing[tag] {
+					n++
+				}
+			}
+			if n > cfg.maxTags {
+				over = append(over, t.ID.Hex())
+			}
+		}
+		if len(over) > 0 {
+			rndr.JSON(w, http.StatusUnprocessableEntity, renderer.M{
+				"errors": []fieldError{{
+					Field:   "add",
+					Pointer: "/add",
+					Message: fmt.Sprintf("A todo cannot have more than %d tags", cfg.maxTags),
+				}},
+				"ids": over,
+			})
+			return
+		}
+	}
+
+	// $addToSet leaves todos that already carry a tag untouched, so repeating
+	// a request is harmless.
+	if len(add) > 0 {
+		var info *mgo.ChangeInfo
+		if err := timeQuery(r.Context(), "updateAll", selector, func() (err error) {
+			info, err = c.UpdateAll(selector, bson.M{"$addToSet": bson.M{"tags": bson.M{"$each": add}}})
+			return err
+		}); err != nil {
+			renderDBError(w, "Failed to add tags", err)
+			return
+		}
+		added = info.Updated
+	}
+	if len(remove) > 0 {
+		var info *mgo.ChangeInfo
+		if err := timeQuery(r.Context(), "updateAll", selector, func() (err error) {
+			info, err = c.UpdateAll(selector, bson.M{"$pull": bson.M{"tags": bson.M{"$in": remove}}})
+			return err
+		}); err != nil {
+			renderDBError(w, "Failed to remove tags", err)
+			return
+		}
+		removed = info.Updated
+	}
+
+	respondOK(w, http.StatusOK, renderer.M{
+		"added":   added,
+		"removed": removed,
+	}, renderer.M{
+		"message": "TODO tags updated successfully.",
+	})
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// timeoutBody is the response of a request that ran past REQUEST_TIMEOUT.
+const timeoutBody = `{"error":"The request took too long, please retry later."}`
+
+// errRequestTimeout is what writes return once REQUEST_TIMEOUT has passed.
+var errRequestTimeout = errors.New("request timed out")
+
+// requestTimeout bounds a request to cfg.requestTimeout through a deadline on
+// its context. mgo doesn't take a context, so the DB side is bounded
+// separately by the session's socket timeout, which connectDB sets to the
+// same duration; the handler then gets back an error once it's past due.
+//
+// Unlike http.TimeoutHandler nothing is buffered, so streamed lists still
+// go out as they're written. A handler that only answers after the
+// deadline has its response replaced by a 503 with timeoutBody, and one
+// still writing when it passes is cut short.
+func requestTimeout(next http.Handler) http.Handler {
+	if cfg.requestTimeout == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), cfg.requestTimeout)
+		defer cancel()
+
+		tw := &timeoutWriter{ResponseWriter: w, ctx: ctx}
+		next.ServeHTTP(tw, r.WithContext(ctx))
+		if !tw.started && !tw.timedOut && tw.expired() {
+			tw.timeOut()
+		}
+	})
+}
+
+// timeoutWriter passes a response through as long as the request's
+// deadline hasn't passed.
+type timeoutWriter struct {
+	http.ResponseWriter
+	ctx      context.Context
+	started  bool
+	timedOut bool
+}
+
+func (tw *timeoutWriter) expired() bool {
+	return tw.ctx.Err() == context.DeadlineExceeded
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	if tw.timedOut {
+		return
+	}
+	if !tw.started && tw.expired() {
+		tw.timeOut()
+		return
+	}
+	tw.started = true
+	tw.ResponseWriter.WriteHeader(status)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	if !tw.started && !tw.timedOut {
+		tw.WriteHeader(http.StatusOK)
+	}
+	if tw.timedOut || tw.expired() {
+		return 0, errRequestTimeout
+	}
+	return tw.ResponseWriter.Write(b)
+}
+
+// timeOut sends the timeout response in place of the handler's.
+func (tw *timeoutWriter) timeOut() {
+	tw.timedOut = true
+	h := tw.ResponseWriter.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/json; charset=UTF-8")
+	tw.ResponseWriter.WriteHeader(http.StatusServiceUnavailable)
+	tw.ResponseWriter.Write([]byte(timeoutBody))
+}
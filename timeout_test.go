@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// slowStore stands in for a DB call that takes delay, returning early with
+// a socket-timeout-like error once the request's deadline passes.
+func slowStore(r *http.Request, delay time.Duration) error {
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-r.Context().Done():
+		return errors.New("i/o timeout")
+	}
+}
+
+func withRequestTimeout(t *testing.T, d time.Duration) {
+	prev := cfg.requestTimeout
+	cfg.requestTimeout = d
+	t.Cleanup(func() { cfg.requestTimeout = prev })
+}
+
+func TestRequestTimeoutSlowStore(t *testing.T) {
+	withRequestTimeout(t, 20*time.Millisecond)
+	h := requestTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := slowStore(r, time.Second); err != nil {
+			renderDBError(w, "Failed to fetch todo", err)
+			return
+		}
+		respondOK(w, http.StatusOK, "done", nil)
+	}))
+
+	start := time.Now()
+	w := serve(h, http.MethodGet, "/todo", "")
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("request took %s, want it bounded by the timeout", elapsed)
+	}
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", w.Code)
+	}
+	if w.Body.String() != timeoutBody {
+		t.Errorf("body = %q, want %q", w.Body, timeoutBody)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=UTF-8" {
+		t.Errorf("Content-Type = %q, want JSON", ct)
+	}
+}
+
+func TestRequestTimeoutSilentHandler(t *testing.T) {
+	withRequestTimeout(t, 10*time.Millisecond)
+	h := requestTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+
+	w := serve(h, http.MethodGet, "/todo", "")
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != timeoutBody {
+		t.Errorf("got %d %q, want the 503 timeout response", w.Code, w.Body)
+	}
+}
+
+func TestRequestTimeoutInTime(t *testing.T) {
+	withRequestTimeout(t, time.Second)
+	h := requestTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := slowStore(r, time.Millisecond); err != nil {
+			renderDBError(w, "Failed to fetch todo", err)
+			return
+		}
+		respondOK(w, http.StatusCreated, "done", nil)
+	}))
+
+	w := serve(h, http.MethodPost, "/todo", "")
+	if w.Code != http.StatusCreated || w.Body.String() != `{"data":"done"}` {
+		t.Errorf("got %d %q, want the handler's response", w.Code, w.Body)
+	}
+}
+
+// A streamed response goes out as it's written, and is cut once the
+// deadline passes.
+func TestRequestTimeoutStreams(t *testing.T) {
+	withRequestTimeout(t, 50*time.Millisecond)
+	w := httptest.NewRecorder()
+	var lateErr error
+	h := requestTimeout(http.HandlerFunc(func(tw http.ResponseWriter, r *http.Request) {
+		tw.WriteHeader(http.StatusOK)
+		tw.Write([]byte(`{"data":[`))
+		if w.Body.String() != `{"data":[` {
+			t.Errorf("body = %q before the handler returned, want it written through", w.Body)
+		}
+		<-r.Context().Done()
+		_, lateErr = tw.Write([]byte(`]}`))
+	}))
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todo", nil))
+
+	if w.Code != http.StatusOK || w.Body.String() != `{"data":[` {
+		t.Errorf("got %d %q, want the 200 and the part written in time", w.Code, w.Body)
+	}
+	if lateErr != errRequestTimeout {
+		t.Errorf("late write error = %v, want errRequestTimeout", lateErr)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// dbTime adds up the time a request spends in timeQuery.
+type dbTime struct {
+	nanos int64
+}
+
+type dbTimeKey struct{}
+
+// addDBTime counts elapsed towards the DB time of the request behind ctx,
+// if it's being timed.
+func addDBTime(ctx context.Context, elapsed time.Duration) {
+	if d, ok := ctx.Value(dbTimeKey{}).(*dbTime); ok {
+		atomic.AddInt64(&d.nanos, int64(elapsed))
+	}
+}
+
+// timingWriter stamps the elapsed time on the response headers right before
+// they're sent, which is as late as a header can still be added. The DB
+// time is the one spent until then; the rest of a streamed list isn't in it.
+type timingWriter struct {
+	http.ResponseWriter
+	start       time.Time
+	db          *dbTime
+	wroteHeader bool
+}
+
+func (tw *timingWriter) WriteHeader(status int) {
+	if !tw.wroteHeader {
+		tw.wroteHeader = true
+		ms := float64(time.Since(tw.start).Microseconds()) / 1000
+		tw.Header().Set("X-Response-Time", fmt.Sprintf("%.2fms", ms))
+		dbMs := float64(atomic.LoadInt64(&tw.db.nanos)) / float64(time.Millisecond)
+		tw.Header().Set("Server-Timing", fmt.Sprintf("total;dur=%.2f, db;dur=%.2f", ms, dbMs))
+	}
+	tw.ResponseWriter.WriteHeader(status)
+}
+
+func (tw *timingWriter) Write(b []byte) (int, error) {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	return tw.ResponseWriter.Write(b)
+}
+
+// responseTiming adds X-Response-Time and Server-Timing to every response
+// when TIMING_HEADERS is on. Server-Timing breaks the DB operations run
+// through timeQuery out of the total.
+func responseTiming(next http.Handler) http.Handler {
+	if !cfg.timingHeaders {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		db := &dbTime{}
+		ctx := context.WithValue(r.Context(), dbTimeKey{}, db)
+		next.ServeHTTP(&timingWriter{ResponseWriter: w, start: time.Now(), db: db}, r.WithContext(ctx))
+	})
+}
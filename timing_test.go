@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestServerTimingBreaksOutDBTime(t *testing.T) {
+	prev := cfg.timingHeaders
+	cfg.timingHeaders = true
+	t.Cleanup(func() { cfg.timingHeaders = prev })
+
+	h := responseTiming(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 2; i++ {
+			timeQuery(r.Context(), "find", nil, func() error {
+				time.Sleep(10 * time.Millisecond)
+				return nil
+			})
+		}
+		time.Sleep(10 * time.Millisecond)
+		respondOK(w, http.StatusOK, nil, nil)
+	}))
+
+	w := serve(h, http.MethodGet, "/todo", "")
+	header := w.Header().Get("Server-Timing")
+	m := regexp.MustCompile(`^total;dur=([0-9.]+), db;dur=([0-9.]+)$`).FindStringSubmatch(header)
+	if m == nil {
+		t.Fatalf("Server-Timing = %q, want total and db entries", header)
+	}
+	total, _ := strconv.ParseFloat(m[1], 64)
+	db, _ := strconv.ParseFloat(m[2], 64)
+	if db < 20 || db >= total {
+		t.Errorf("db;dur=%v with total;dur=%v, want the 20ms of queries, less than the total", db, total)
+	}
+}
+
+func TestServerTimingWithoutQueries(t *testing.T) {
+	prev := cfg.timingHeaders
+	cfg.timingHeaders = true
+	t.Cleanup(func() { cfg.timingHeaders = prev })
+
+	h := responseTiming(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respondOK(w, http.StatusOK, nil, nil)
+	}))
+	w := serve(h, http.MethodGet, "/", "")
+	if ok, _ := regexp.MatchString(`db;dur=0\.00$`, w.Header().Get("Server-Timing")); !ok {
+		t.Errorf("Server-Timing = %q, want db;dur=0.00", w.Header().Get("Server-Timing"))
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"time"
+)
+
+// fetchTodayTodo renders what is actionable today: open todos due before the
+// end of today in the viewer's ?tz=, overdue ones included, most important
+// first and then soonest due.
+func fetchTodayTodo(w http.ResponseWriter, r *http.Request) {
+	loc, ok := parseTimezone(w, r)
+	if !ok {
+		return
+	}
+
+	filter, err := todoFilter(r)
+	if err != nil {
+		rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	now := time.Now().In(loc)
+	endOfToday := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, loc)
+	filter["completed"] = false
+	filter["archived"] = bson.M{"$ne": true}
+	filter["dueDate"] = bson.M{"$lt": endOfToday}
+
+	todos := []todoModel{}
+	if err := timeQuery(r.Context(), "find", filter, func() error {
+		return db.C(collectionName).Find(filter).Sort("-priority", "dueDate", "_id").Limit(cfg.maxPageSize).All(&todos)
+	}); err != nil {
+		renderDBError(w, "Failed to fetch todo", err)
+		return
+	}
+
+	renderTodoList(w, todos, loc, nil)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"strings"
+)
+
+// maxToggleAttempts bounds the compare-and-set retries of a toggle racing
+// other writers.
+const maxToggleAttempts = 3
+
+// toggleTodo flips completed. findAndModify can't negate a field by itself,
+// so the current state is read and the flip only applies while it still
+// holds; a concurrent toggle in between makes it re-read and retry.
+func toggleTodo(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+
+	if !bson.IsObjectIdHex(id) {
+		if err1 := rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "Invalid URL request",
+		}); err1 != nil {
+			renderFailed(err1)
+			return
+		}
+		return
+	}
+
+	loc, ok := parseTimezone(w, r)
+	if !ok {
+		return
+	}
+
+	c := db.C(collectionName)
+	for attempt := 0; attempt < maxToggleAttempts; attempt++ {
+		var current todoModel
+		selector := activeTodo(bson.ObjectIdHex(id))
+		if err := timeQuery(r.Context(), "findOne", selector, func() error {
+			return c.Find(selector).Select(bson.M{"completed": 1}).One(&current)
+		}); err != nil {
+			if err == mgo.ErrNotFound {
+				renderMissingTodo(w, r, bson.ObjectIdHex(id))
+				return
+			}
+			renderDBError(w, "Failed to toggle TODO", err)
+			return
+		}
+
+		completed := !current.Completed
+		update := bson.M{"$set": bson.M{"completed": completed}}
+		setCompletion(update, completed)
+		setExpiry(update, completed)
+
+		var tm todoModel
+		selector["completed"] = current.Completed
+		err := timeQuery(r.Context(), "findAndModify", selector, func() (err error) {
+			_, err = c.Find(selector).Apply(mgo.Change{Update: update, ReturnNew: true}, &tm)
+			return err
+		})
+		if err == nil {
+			respondOK(w, http.StatusOK, toTodo(tm, loc), nil)
+			return
+		}
+		if err != mgo.ErrNotFound {
+			renderDBError(w, "Failed to toggle TODO", err)
+			return
+		}
+	}
+
+	w.Header().Set("Retry-After", "1")
+	rndr.JSON(w, http.StatusConflict, renderer.M{
+		"error": "The TODO kept changing while toggling it, please retry",
+	})
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/thedevsaddam/renderer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// purgeConfirmHeader must be "true" on DELETE /todo/trash, which can't be
+// undone.
+const purgeConfirmHeader = "X-Confirm-Purge"
+
+// notDeleted selects the todos that aren't in the trash.
+func notDeleted() bson.M {
+	return bson.M{"deletedAt": bson.M{"$exists": false}}
+}
+
+// trashUpdate is the update moving todos to the trash. They're unpinned on
+// the way, so a trashed todo doesn't hold a pin slot; the caller releases
+// their slots once the update went through.
+func trashUpdate() bson.M {
+	return bson.M{"$set": bson.M{"deletedAt": time.Now().UTC(), "pinned": false}}
+}
+
+// activeTodo selects the todo with the given id unless it's in the trash.
+// Mutations go through it so that they never land on a deleted todo.
+func activeTodo(id bson.ObjectId) bson.M {
+	selector := notDeleted()
+	selector["_id"] = id
+	return selector
+}
+
+// renderMissingTodo explains why an activeTodo selector matched nothing: a
+// todo someone else deleted gets a 409 pointing at the restore endpoint,
+// anything else a 404.
+func renderMissingTodo(w http.ResponseWriter, r *http.Request, id bson.ObjectId) {
+	selector := bson.M{"_id": id}
+	var n int
+	err := timeQuery(r.Context(), "count", selector, func() (err error) {
+		n, err = db.C(collectionName).Find(selector).Count()
+		return err
+	})
+	if err == nil && n > 0 {
+		rndr.JSON(w, http.StatusConflict, renderer.M{
+			"error": "This TODO was deleted, restore it first to change it",
+		})
+		return
+	}
+	rndr.JSON(w, http.StatusNotFound, renderer.M{
+		"error": "TODO not found",
+	})
+}
+
+func fetchTrash(w http.ResponseWriter, r *http.Request) {
+	loc, ok := parseTimezone(w, r)
+	if !ok {
+		return
+	}
+
+	listTodos(w, r, bson.M{"deletedAt": bson.M{"$exists": true}}, loc)
+}
+
+// parseAge parses an age such as ?olderThan=, either a Go duration ("12h") or a
+// number of days ("30d").
+func parseAge(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil || days < 0 {
+			return 0, errors.New("Invalid olderThan " + s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, errors.New("Invalid olderThan " + s)
+	}
+	return d, nil
+}
+
+func purgeTrash(w http.ResponseWriter, r *http.Request) {
+	deleted := bson.M{"$exists": true}
+	if s := r.URL.Query().Get("olderThan"); s != "" {
+		age, err := parseAge(s)
+		if err != nil {
+			rndr.JSON(w, http.StatusBadRequest, renderer.M{
+				"error": err.Error(),
+			})
+			return
+		}
+		deleted["$lt"] = time.Now().UTC().Add(-age)
+	}
+	filter := bson.M{"deletedAt": deleted}
+
+	if isDryRun(r) {
+		renderWouldAffect(w, r, filter)
+		return
+	}
+
+	if r.Header.Get(purgeConfirmHeader) != "true" {
+		rndr.JSON(w, http.StatusPreconditionRequired, renderer.M{
+			"error": "Purging the trash can't be undone, send " + purgeConfirmHeader + ": true to confirm",
+		})
+		return
+	}
+
+	purged, ok := removeTodos(w, r, filter)
+	if !ok {
+		return
+	}
+
+	respondOK(w, http.StatusOK, renderer.M{
+		"purged": purged,
+	}, renderer.M{
+		"message": "Trash emptied successfully.",
+	})
+}
+
+func restoreTodo(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+
+	if !bson.IsObjectIdHex(id) {
+		if err1 := rndr.JSON(w, http.StatusBadRequest, renderer.M{
+			"error": "Invalid URL request",
+		}); err1 != nil {
+			renderFailed(err1)
+			return
+		}
+		return
+	}
+
+	// The todo's old position may have been handed out while it was in the
+	// trash, so it comes back at the end of the list, and unpinned like
+	// every trashed todo.
+	position, err := nextPosition(r.Context())
+	if err != nil {
+		renderDBError(w, "Failed to restore TODO", err)
+		return
+	}
+
+	selector := bson.M{"_id": bson.ObjectIdHex(id), "deletedAt": bson.M{"$exists": true}}
+	if err := timeQuery(r.Context(), "update", selector, func() error {
+		return db.C(collectionName).Update(selector, bson.M{
+			"$set":   bson.M{"position": position, "pinned": false},
+			"$unset": bson.M{"deletedAt": ""},
+		})
+	}); err != nil {
+		if err == mgo.ErrNotFound {
+			rndr.JSON(w, http.StatusNotFound, renderer.M{
+				"error": "No deleted TODO with this id",
+			})
+			return
+		}
+		renderDBError(w, "Failed to restore TODO", err)
+		return
+	}
+
+	respondOK(w, http.StatusOK, renderer.M{
+		"id": id,
+	}, renderer.M{
+		"message": "TODO restored successfully.",
+	})
+}
+
+// trashRequest lists the todos DELETE /todo moves to the trash.
+type trashRequest struct {
+	IDs batchIDs `json:"ids"`
+}
+
+// trashTodos moves every listed todo to the trash at once, for multi-select
+// deletes. Ids already in the trash or unknown are reported as notFound.
+func trashTodos(w http.ResponseWriter, r *http.Request) {
+	var req trashRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		renderBadBody(w, err)
+		return
+	}
+
+	ids, ok := parseIDs(w, req.IDs)
+	if !ok {
+		return
+	}
+	notFound, ok := missingIDs(w, r, ids)
+	if !ok {
+		return
+	}
+
+	var info *mgo.ChangeInfo
+	selector := activeTodos(ids)
+	if err := timeQuery(r.Context(), "updateAll", selector, func() (err error) {
+		info, err = db.C(collectionName).UpdateAll(selector, trashUpdate())
+		return err
+	}); err != nil {
+		renderDBError(w, "Failed to remove TODOs", err)
+		return
+	}
+	releasePins(r.Context(), ids...)
+
+	respondOK(w, http.StatusOK, renderer.M{
+		"trashed":  info.Updated,
+		"notFound": notFound,
+	}, renderer.M{
+		"message": "TODOs moved to the trash.",
+	})
+}
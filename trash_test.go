@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"testing"
+)
+
+// A client that still shows a todo someone else just deleted must not
+// change the tombstone: every write gets a 409 until the todo is restored.
+func TestUpdateAfterDelete(t *testing.T) {
+	testDB(t)
+	h := todoHandler()
+	id := insertTodo(t, todoModel{Title: "Ship it", Priority: priorityRanks["medium"]})
+	path := "/" + id.Hex()
+
+	if w := serve(h, http.MethodDelete, path, ""); w.Code != http.StatusOK {
+		t.Fatalf("DELETE = %d %s, want 200", w.Code, w.Body)
+	}
+
+	writes := []struct {
+		method, path, body string
+	}{
+		{http.MethodPut, path, `{"title":"Ship it now"}`},
+		{http.MethodPatch, path, `{"completed":true}`},
+		{http.MethodPost, path + "/toggle", ""},
+		{http.MethodPost, path + "/archive", ""},
+		{http.MethodDelete, path, ""},
+	}
+	for _, wr := range writes {
+		w := serve(h, wr.method, wr.path, wr.body)
+		if w.Code != http.StatusConflict {
+			t.Errorf("%s %s after delete = %d %s, want 409", wr.method, wr.path, w.Code, w.Body)
+		}
+	}
+
+	tm := storedTodo(t, id)
+	if tm.Title != "Ship it" || tm.Completed || tm.Archived || tm.DeletedAt == nil {
+		t.Errorf("deleted todo changed to %+v", tm)
+	}
+
+	if w := serve(h, http.MethodPost, path+"/restore", ""); w.Code != http.StatusOK {
+		t.Fatalf("restore = %d %s, want 200", w.Code, w.Body)
+	}
+	if w := serve(h, http.MethodPatch, path, `{"completed":true}`); w.Code != http.StatusOK {
+		t.Errorf("PATCH after restore = %d %s, want 200", w.Code, w.Body)
+	}
+}
+
+// The comments of a trashed todo are as frozen as the todo itself.
+func TestCommentsAfterDelete(t *testing.T) {
+	testDB(t)
+	h := todoHandler()
+	id := insertTodo(t, todoModel{Title: "Ship it", Priority: priorityRanks["medium"]})
+	path := "/" + id.Hex() + "/comments"
+
+	w := serve(h, http.MethodPost, path, `{"body":"Looks good"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST comment = %d %s, want 201", w.Code, w.Body)
+	}
+	var created struct {
+		Data comment `json:"data"`
+	}
+	decodeBody(t, w, &created)
+
+	if w := serve(h, http.MethodDelete, "/"+id.Hex(), ""); w.Code != http.StatusOK {
+		t.Fatalf("DELETE = %d %s, want 200", w.Code, w.Body)
+	}
+
+	if w := serve(h, http.MethodGet, path, ""); w.Code != http.StatusConflict {
+		t.Errorf("GET comments after delete = %d %s, want 409", w.Code, w.Body)
+	}
+	if w := serve(h, http.MethodDelete, path+"/"+created.Data.ID, ""); w.Code != http.StatusConflict {
+		t.Errorf("DELETE comment after delete = %d %s, want 409", w.Code, w.Body)
+	}
+	if n, err := db.C(commentsName).FindId(bson.ObjectIdHex(created.Data.ID)).Count(); err != nil || n != 1 {
+		t.Errorf("comment count = %d, %v, want the comment kept", n, err)
+	}
+	if tm := storedTodo(t, id); tm.CommentCount != 1 {
+		t.Errorf("commentCount = %d, want 1", tm.CommentCount)
+	}
+}
+
+// Trashed todos don't hold positions: new todos and restores go after the
+// live ones only.
+func TestTrashedTodosKeepOutOfPositions(t *testing.T) {
+	testDB(t)
+	h := todoHandler()
+	first := insertTodo(t, todoModel{Title: "first", Position: 0})
+	trashed := insertTodo(t, todoModel{Title: "trashed", Position: 1})
+
+	if w := serve(h, http.MethodDelete, "/"+trashed.Hex(), ""); w.Code != http.StatusOK {
+		t.Fatalf("DELETE = %d %s, want 200", w.Code, w.Body)
+	}
+	if n, err := nextPosition(context.Background()); err != nil || n != 1 {
+		t.Errorf("nextPosition(context.Background()) = %d, %v, want 1", n, err)
+	}
+
+	second := insertTodo(t, todoModel{Title: "second", Position: 1})
+	if w := serve(h, http.MethodPost, "/"+first.Hex()+"/move", `{"position":1}`); w.Code != http.StatusOK {
+		t.Fatalf("move = %d %s, want 200", w.Code, w.Body)
+	}
+	if p := storedTodo(t, trashed).Position; p != 1 {
+		t.Errorf("trashed todo moved to %d, want it left at 1", p)
+	}
+	if p := storedTodo(t, second).Position; p != 0 {
+		t.Errorf("second todo at %d, want 0", p)
+	}
+
+	if w := serve(h, http.MethodPost, "/"+trashed.Hex()+"/restore", ""); w.Code != http.StatusOK {
+		t.Fatalf("restore = %d %s, want 200", w.Code, w.Body)
+	}
+	if p := storedTodo(t, trashed).Position; p != 2 {
+		t.Errorf("restored todo at %d, want 2", p)
+	}
+}
+
+func TestClearCompletedMovesToTrash(t *testing.T) {
+	testDB(t)
+	done := insertTodo(t, todoModel{Title: "done", Completed: true})
+	archived := insertTodo(t, todoModel{Title: "archived", Completed: true, Archived: true})
+	open := insertTodo(t, todoModel{Title: "open"})
+
+	if w := serve(todoHandler(), http.MethodDelete, "/completed", ""); w.Code != http.StatusOK {
+		t.Fatalf("DELETE /completed = %d %s, want 200", w.Code, w.Body)
+	}
+	if storedTodo(t, done).DeletedAt == nil {
+		t.Error("completed todo wasn't moved to the trash")
+	}
+	if storedTodo(t, archived).DeletedAt != nil {
+		t.Error("archived todo was moved to the trash")
+	}
+	if storedTodo(t, open).DeletedAt != nil {
+		t.Error("open todo was moved to the trash")
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+// PUT replaces the todo, so an optional field left out of the body is
+// cleared; PATCH only touches what the body names.
+func TestPutClearsOmittedFieldsPatchKeepsThem(t *testing.T) {
+	testDB(t)
+	h := todoHandler()
+	stored := todoModel{
+		Title:           "Ship it",
+		Description:     "before Friday",
+		Assignee:        "ana",
+		EstimateMinutes: 30,
+		Priority:        priorityRanks["high"],
+		Metadata:        map[string]string{"team": "web"},
+	}
+
+	patched := insertTodo(t, stored)
+	if w := serve(h, http.MethodPatch, "/"+patched.Hex(), `{"title":"Ship it now"}`); w.Code != http.StatusOK {
+		t.Fatalf("PATCH = %d %s, want 200", w.Code, w.Body)
+	}
+	tm := storedTodo(t, patched)
+	if tm.Title != "Ship it now" {
+		t.Errorf("PATCH title = %q, want %q", tm.Title, "Ship it now")
+	}
+	if tm.Description != stored.Description || tm.Assignee != stored.Assignee ||
+		tm.EstimateMinutes != stored.EstimateMinutes || tm.Priority != stored.Priority || tm.Metadata["team"] != "web" {
+		t.Errorf("PATCH dropped fields it wasn't given: %+v", tm)
+	}
+
+	replaced := insertTodo(t, stored)
+	if w := serve(h, http.MethodPut, "/"+replaced.Hex(), `{"title":"Ship it now"}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT = %d %s, want 200", w.Code, w.Body)
+	}
+	tm = storedTodo(t, replaced)
+	if tm.Title != "Ship it now" {
+		t.Errorf("PUT title = %q, want %q", tm.Title, "Ship it now")
+	}
+	if tm.Description != "" || tm.Assignee != "" || tm.EstimateMinutes != 0 || tm.Priority != 0 || tm.Metadata != nil {
+		t.Errorf("PUT kept fields left out of the body: %+v", tm)
+	}
+}
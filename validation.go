@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// fieldError describes one invalid field of a request payload. Pointer is
+// the JSON Pointer to the offending value within the payload.
+type fieldError struct {
+	Field   string `json:"field"`
+	Pointer string `json:"pointer,omitempty"`
+	Message string `json:"message"`
+}
+
+// validateTodo normalizes the title, assignee, tags and externalId of a
+// create/update payload, checks every field and returns all the problems
+// found, so a client can report them together.
+func validateTodo(t *todo) []fieldError {
+	errs := []fieldError{}
+	t.Assignee = strings.TrimSpace(t.Assignee)
+	t.Tags = normalizeTags(t.Tags)
+	t.ExternalID = strings.TrimSpace(t.ExternalID)
+
+	title, err := validateTitle(t.Title)
+	t.Title = title
+	if err != nil {
+		errs = append(errs, fieldError{Field: "title", Message: err.Error()})
+	}
+
+	if utf8.RuneCountInString(t.Description) > maxDescriptionLength {
+		errs = append(errs, fieldError{Field: "description", Message: fmt.Sprintf("The description cannot be longer than %d characters", maxDescriptionLength)})
+	}
+
+	if utf8.RuneCountInString(t.Assignee) > maxAssigneeLength {
+		errs = append(errs, fieldError{Field: "assignee", Message: fmt.Sprintf("The assignee cannot be longer than %d characters", maxAssigneeLength)})
+	}
+
+	if t.EstimateMinutes < 0 {
+		errs = append(errs, fieldError{Field: "estimateMinutes", Message: "The estimate cannot be negative"})
+	}
+
+	if err := validateSortKey(t.SortKey); err != "" {
+		errs = append(errs, fieldError{Field: "sortKey", Message: err})
+	}
+
+	if _, ok := priorityRanks[t.Priority]; !ok {
+		errs = append(errs, fieldError{Field: "priority", Message: "The priority must be low, medium or high"})
+	}
+
+	if len(t.Tags) > cfg.maxTags {
+		errs = append(errs, fieldError{Field: "tags", Message: fmt.Sprintf("A todo cannot have more than %d tags", cfg.maxTags)})
+	}
+	for _, tag := range t.Tags {
+		if err := validateTag(tag); err != "" {
+			errs = append(errs, fieldError{Field: "tags", Message: err})
+		}
+	}
+
+	if len(t.Metadata) > cfg.maxMetadataEntries {
+		errs = append(errs, fieldError{Field: "metadata", Message: fmt.Sprintf("A todo cannot have more than %d metadata entries", cfg.maxMetadataEntries)})
+	}
+	keys := make([]string, 0, len(t.Metadata))
+	for key := range t.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := validateMetadata(key, t.Metadata[key]); err != "" {
+			errs = append(errs, fieldError{Field: "metadata", Message: err})
+		}
+	}
+
+	for i := range errs {
+		errs[i].Pointer = "/" + errs[i].Field
+	}
+	return errs
+}
+
+// metadataKeyPattern keeps metadata keys usable as a Mongo path and a query
+// param: no dots, no leading "$" or "_".
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// reservedMetadataPrefix is kept for keys the service may set itself.
+const reservedMetadataPrefix = "todo-"
+
+// validateMetadata returns why a metadata entry is invalid, or "" when it's
+// fine.
+func validateMetadata(key, value string) string {
+	switch {
+	case utf8.RuneCountInString(key) > maxMetadataKeyLength:
+		return fmt.Sprintf("The metadata key %q cannot be longer than %d characters", key, maxMetadataKeyLength)
+	case !metadataKeyPattern.MatchString(key):
+		return fmt.Sprintf("The metadata key %q may only contain letters, digits, \"-\" and \"_\", and cannot start with \"_\"", key)
+	case strings.HasPrefix(strings.ToLower(key), reservedMetadataPrefix):
+		return fmt.Sprintf("The metadata key %q is reserved", key)
+	case utf8.RuneCountInString(value) > maxMetadataValueLength:
+		return fmt.Sprintf("The metadata value of %q cannot be longer than %d characters", key, maxMetadataValueLength)
+	}
+	return ""
+}
+
+// checkDueDate flags a due date before the todo's creation time, which is
+// usually a backdating mistake. It's a warning unless strict, as asked for
+// with ?strictDates=true, makes it an error.
+func checkDueDate(t *todo, strict bool) (errs, warnings []fieldError) {
+	errs, warnings = []fieldError{}, []fieldError{}
+	if t.DueDate == nil || !t.DueDate.Before(t.CreatedAt) {
+		return errs, warnings
+	}
+	e := fieldError{Field: "dueDate", Pointer: "/dueDate", Message: "The due date is before the creation date"}
+	if strict {
+		return append(errs, e), warnings
+	}
+	return errs, append(warnings, e)
+}
+
+// strictDates reports whether the request asks for date inconsistencies to
+// be rejected rather than warned about.
+func strictDates(r *http.Request) bool {
+	return r.URL.Query().Get("strictDates") == "true"
+}
+
+// validateTitle trims a title and collapses its inner whitespace, newlines
+// and unicode spaces included, then checks it's neither empty nor too long.
+// The normalized title is returned even when it's invalid.
+func validateTitle(s string) (string, error) {
+	title := strings.Join(strings.Fields(s), " ")
+	if title == "" {
+		return title, errors.New("The title cannot be empty")
+	}
+	if utf8.RuneCountInString(title) > maxTitleLength {
+		return title, fmt.Errorf("The title cannot be longer than %d characters", maxTitleLength)
+	}
+	return title, nil
+}
+
+// validateTag returns why a normalized tag is invalid, or "" when it's fine.
+func validateTag(tag string) string {
+	if utf8.RuneCountInString(tag) > maxTagLength {
+		return fmt.Sprintf("The tag %q cannot be longer than %d characters", tag, maxTagLength)
+	}
+	return ""
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateTitle(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    string
+		want  string
+		valid bool
+	}{
+		{"plain", "Buy milk", "Buy milk", true},
+		{"empty", "", "", false},
+		{"spaces only", "    ", "", false},
+		{"tabs only", "\t\t", "", false},
+		{"newlines only", "\n\r\n", "", false},
+		{"no-break spaces only", "\u00a0\u00a0", "", false},
+		{"ideographic space only", "\u3000", "", false},
+		{"surrounding whitespace", " \tBuy milk\n ", "Buy milk", true},
+		{"inner tabs and newlines", "Buy\tmilk\nand\r\neggs", "Buy milk and eggs", true},
+		{"inner runs of spaces", "Buy    milk", "Buy milk", true},
+		{"unicode spaces", "Buy\u00a0milk\u2003now", "Buy milk now", true},
+		{"zero-width space is not whitespace", "\u200b", "\u200b", true},
+		{"max length", strings.Repeat("a", maxTitleLength), strings.Repeat("a", maxTitleLength), true},
+		{"max length in runes", strings.Repeat("\u00e9", maxTitleLength), strings.Repeat("\u00e9", maxTitleLength), true},
+		{"over max length", strings.Repeat("a", maxTitleLength+1), strings.Repeat("a", maxTitleLength+1), false},
+		{"collapsed under max length", strings.Repeat("a ", maxTitleLength/2) + "   ", strings.TrimSpace(strings.Repeat("a ", maxTitleLength/2)), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateTitle(tt.in)
+			if got != tt.want {
+				t.Errorf("validateTitle(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			if (err == nil) != tt.valid {
+				t.Errorf("validateTitle(%q) error = %v, want valid %v", tt.in, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestValidateTodoTrimsTitle(t *testing.T) {
+	td := todo{Title: "\t Buy  milk \n", Priority: "medium"}
+	if errs := validateTodo(&td); len(errs) != 0 {
+		t.Fatalf("validateTodo() = %v, want no errors", errs)
+	}
+	if td.Title != "Buy milk" {
+		t.Errorf("title = %q, want %q", td.Title, "Buy milk")
+	}
+
+	td = todo{Title: "\u00a0 \t", Priority: "medium"}
+	errs := validateTodo(&td)
+	if len(errs) != 1 || errs[0].Field != "title" || errs[0].Pointer != "/title" {
+		t.Errorf("validateTodo() = %v, want one title error", errs)
+	}
+}
+
+func TestCheckDueDate(t *testing.T) {
+	created := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	before, after := created.Add(-time.Hour), created.Add(time.Hour)
+	tests := []struct {
+		name             string
+		due              *time.Time
+		strict           bool
+		errors, warnings int
+	}{
+		{"no due date", nil, true, 0, 0},
+		{"due after creation", &after, true, 0, 0},
+		{"due at creation", &created, true, 0, 0},
+		{"backdated", &before, false, 0, 1},
+		{"backdated, strict", &before, true, 1, 0},
+	}
+	for _, tt := range tests {
+		errs, warnings := checkDueDate(&todo{CreatedAt: created, DueDate: tt.due}, tt.strict)
+		if len(errs) != tt.errors || len(warnings) != tt.warnings {
+			t.Errorf("%s: %d errors and %d warnings, want %d and %d", tt.name, len(errs), len(warnings), tt.errors, tt.warnings)
+		}
+		for _, e := range append(errs, warnings...) {
+			if e.Field != "dueDate" {
+				t.Errorf("%s: flagged field %q, want dueDate", tt.name, e.Field)
+			}
+		}
+	}
+}
+
+func TestStrictDates(t *testing.T) {
+	for query, want := range map[string]bool{"": false, "?strictDates=true": true, "?strictDates=false": false, "?strictDates=1": false} {
+		if got := strictDates(httptest.NewRequest("POST", "/todo"+query, nil)); got != want {
+			t.Errorf("strictDates(%q) = %v, want %v", query, got, want)
+		}
+	}
+}
+
+// A backdated todo is accepted with a warning, and rejected with a 422 once
+// ?strictDates=true asks for it.
+func TestBackdatedDueDate(t *testing.T) {
+	h := todoHandler()
+	body := `{"title":"Ship it","dueDate":"2001-01-01T00:00:00Z"}`
+
+	w := serve(h, http.MethodPost, "/validate", body)
+	var resp struct {
+		Meta struct {
+			Warnings []fieldError `json:"warnings"`
+		} `json:"meta"`
+	}
+	decodeBody(t, w, &resp)
+	if w.Code != http.StatusOK || len(resp.Meta.Warnings) != 1 {
+		t.Errorf("lenient = %d %s, want 200 with one warning", w.Code, w.Body)
+	}
+
+	w = serve(h, http.MethodPost, "/validate?strictDates=true", body)
+	var errResp struct {
+		Errors []fieldError `json:"errors"`
+	}
+	decodeBody(t, w, &errResp)
+	if w.Code != http.StatusUnprocessableEntity || len(errResp.Errors) != 1 || errResp.Errors[0].Field != "dueDate" {
+		t.Errorf("strict = %d %s, want 422 on dueDate", w.Code, w.Body)
+	}
+}
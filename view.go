@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+)
+
+const (
+	viewFull    string = "full"
+	viewSummary string = "summary"
+)
+
+// todoSummary is the trimmed ?view=summary form of a todo for list screens.
+type todoSummary struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Completed bool   `json:"completed"`
+	Priority  string `json:"priority"`
+	Pinned    bool   `json:"pinned"`
+}
+
+// parseView reads ?view=, defaulting to the full representation.
+func parseView(r *http.Request) (string, error) {
+	switch view := r.URL.Query().Get("view"); view {
+	case "", viewFull:
+		return viewFull, nil
+	case viewSummary:
+		return viewSummary, nil
+	default:
+		return "", errors.New("Invalid view " + view + ", expected full or summary")
+	}
+}
+
+// viewFields is the projection for a view, so that Mongo does the trimming;
+// nil selects every field.
+func viewFields(view string) bson.M {
+	if view == viewSummary {
+		return bson.M{"title": 1, "completed": 1, "priority": 1, "pinned": 1}
+	}
+	return nil
+}
+
+func toTodoSummary(t todoModel) todoSummary {
+	return todoSummary{
+		ID:        t.ID.Hex(),
+		Title:     t.Title,
+		Completed: t.Completed,
+		Priority:  priorityNames[t.Priority],
+		Pinned:    t.Pinned,
+	}
+}